@@ -24,7 +24,7 @@ _sym_db = _symbol_database.Default()
 
 
 
-DESCRIPTOR = _descriptor_pool.Default().AddSerializedFile(b'\n\x11\x63omunicacao.proto\x12\x0b\x63omunicacao\"\x17\n\x06\x46iltro\x12\r\n\x05termo\x18\x01 \x01(\t\"\x1a\n\tResultado\x12\r\n\x05valor\x18\x01 \x01(\x02\"C\n\nMarcaStats\x12\r\n\x05total\x18\x01 \x01(\x05\x12\x13\n\x0bmedia_preco\x18\x02 \x01(\x02\x12\x11\n\tmedia_kms\x18\x03 \x01(\x02\"=\n\x10LocalizacaoStats\x12\x14\n\x0ctotal_carros\x18\x01 \x01(\x05\x12\x13\n\x0bvalor_total\x18\x02 \x01(\x02\x32\xde\x01\n\x0e\x42IQueryService\x12=\n\rGetMarcaStats\x12\x13.comunicacao.Filtro\x1a\x17.comunicacao.MarcaStats\x12\x42\n\x13GetContagemSegmento\x12\x13.comunicacao.Filtro\x1a\x16.comunicacao.Resultado\x12I\n\x13GetLocalizacaoStats\x12\x13.comunicacao.Filtro\x1a\x1d.comunicacao.LocalizacaoStatsB\x06Z\x04./pbb\x06proto3')
+DESCRIPTOR = _descriptor_pool.Default().AddSerializedFile(b'\n\x11\x63omunicacao.proto\x12\x0b\x63omunicacao\".\n\x06\x46iltro\x12\r\n\x05termo\x18\x01 \x01(\t\x12\x15\n\rapenas_ativos\x18\x02 \x01(\x08\"\x1a\n\tResultado\x12\r\n\x05valor\x18\x01 \x01(\x02\"C\n\nMarcaStats\x12\r\n\x05total\x18\x01 \x01(\x05\x12\x13\n\x0bmedia_preco\x18\x02 \x01(\x02\x12\x11\n\tmedia_kms\x18\x03 \x01(\x02\"=\n\x10LocalizacaoStats\x12\x14\n\x0ctotal_carros\x18\x01 \x01(\x05\x12\x13\n\x0bvalor_total\x18\x02 \x01(\x02\"\x86\x02\n\tEstadoJob\x12\x12\n\nrequest_id\x18\x01 \x01(\t\x12\x11\n\tfile_name\x18\x02 \x01(\t\x12\x0e\n\x06mapper\x18\x03 \x01(\t\x12\x0e\n\x06\x65stado\x18\x04 \x01(\t\x12\x0e\n\x06status\x18\x05 \x01(\t\x12\x11\n\tresultado\x18\x06 \x01(\t\x12\x14\n\x0clinhas_lidas\x18\x07 \x01(\x05\x12\x16\n\x0elinhas_aceites\x18\x08 \x01(\x05\x12\x19\n\x11linhas_rejeitadas\x18\t \x01(\x05\x12\x14\n\x0c\x64\x61ta_criacao\x18\n \x01(\t\x12\x18\n\x10\x64\x61ta_atualizacao\x18\x0b \x01(\t\x12\x16\n\x0e\x64\x61ta_conclusao\x18\x0c \x01(\t\"\x87\x02\n\x10VeiculoHistorico\x12\x12\n\nid_interno\x18\x01 \x01(\t\x12\x12\n\ndesignacao\x18\x02 \x01(\t\x12\x1a\n\x12primeiro_documento\x18\x03 \x01(\x03\x12\x14\n\x0cprimeira_vez\x18\x04 \x01(\t\x12\x18\n\x10ultimo_documento\x18\x05 \x01(\x03\x12\x12\n\nultima_vez\x18\x06 \x01(\t\x12\x13\n\x0bobservacoes\x18\x07 \x01(\x05\x12\x31\n\nalteracoes\x18\x08 \x03(\x0b\x32\x1d.comunicacao.AlteracaoVeiculo\x12\x0e\n\x06\x65stado\x18\t \x01(\t\x12\x13\n\x0b\x64\x61ta_estado\x18\n \x01(\t\"\x92\x01\n\x10\x41lteracaoVeiculo\x12\x14\n\x0c\x64ocumento_id\x18\x01 \x01(\x03\x12\x0c\n\x04\x64\x61ta\x18\x02 \x01(\t\x12\r\n\x05preco\x18\x03 \x01(\x02\x12\x0b\n\x03kms\x18\x04 \x01(\x02\x12\x16\n\x0epreco_anterior\x18\x05 \x01(\x02\x12\x14\n\x0ckms_anterior\x18\x06 \x01(\x02\x12\x10\n\x08primeira\x18\x07 \x01(\x08\"U\n\rDiasNoMercado\x12\x13\n\x0b\x61grupamento\x18\x01 \x01(\t\x12/\n\x06grupos\x18\x02 \x03(\x0b\x32\x1f.comunicacao.DiasNoMercadoGrupo\"\x8a\x01\n\x12\x44iasNoMercadoGrupo\x12\r\n\x05grupo\x18\x01 \x01(\t\x12\x10\n\x08\x61nuncios\x18\x02 \x01(\x05\x12\x0e\n\x06\x61tivos\x18\x03 \x01(\x05\x12\x11\n\tremovidos\x18\x04 \x01(\x05\x12\x12\n\nmedia_dias\x18\x05 \x01(\x02\x12\x1c\n\x14media_dias_removidos\x18\x06 \x01(\x02\x32\xab\x03\n\x0e\x42IQueryService\x12=\n\rGetMarcaStats\x12\x13.comunicacao.Filtro\x1a\x17.comunicacao.MarcaStats\x12\x42\n\x13GetContagemSegmento\x12\x13.comunicacao.Filtro\x1a\x16.comunicacao.Resultado\x12I\n\x13GetLocalizacaoStats\x12\x13.comunicacao.Filtro\x1a\x1d.comunicacao.LocalizacaoStats\x12;\n\x0cGetEstadoJob\x12\x13.comunicacao.Filtro\x1a\x16.comunicacao.EstadoJob\x12I\n\x13GetVeiculoHistorico\x12\x13.comunicacao.Filtro\x1a\x1d.comunicacao.VeiculoHistorico\x12\x43\n\x10GetDiasNoMercado\x12\x13.comunicacao.Filtro\x1a\x1a.comunicacao.DiasNoMercadoB\x06Z\x04./pbb\x06proto3')
 
 _globals = globals()
 _builder.BuildMessageAndEnumDescriptors(DESCRIPTOR, _globals)
@@ -33,13 +33,23 @@ if not _descriptor._USE_C_DESCRIPTORS:
   _globals['DESCRIPTOR']._loaded_options = None
   _globals['DESCRIPTOR']._serialized_options = b'Z\004./pb'
   _globals['_FILTRO']._serialized_start=34
-  _globals['_FILTRO']._serialized_end=57
-  _globals['_RESULTADO']._serialized_start=59
-  _globals['_RESULTADO']._serialized_end=85
-  _globals['_MARCASTATS']._serialized_start=87
-  _globals['_MARCASTATS']._serialized_end=154
-  _globals['_LOCALIZACAOSTATS']._serialized_start=156
-  _globals['_LOCALIZACAOSTATS']._serialized_end=217
-  _globals['_BIQUERYSERVICE']._serialized_start=220
-  _globals['_BIQUERYSERVICE']._serialized_end=442
+  _globals['_FILTRO']._serialized_end=80
+  _globals['_RESULTADO']._serialized_start=82
+  _globals['_RESULTADO']._serialized_end=108
+  _globals['_MARCASTATS']._serialized_start=110
+  _globals['_MARCASTATS']._serialized_end=177
+  _globals['_LOCALIZACAOSTATS']._serialized_start=179
+  _globals['_LOCALIZACAOSTATS']._serialized_end=240
+  _globals['_ESTADOJOB']._serialized_start=243
+  _globals['_ESTADOJOB']._serialized_end=505
+  _globals['_VEICULOHISTORICO']._serialized_start=508
+  _globals['_VEICULOHISTORICO']._serialized_end=771
+  _globals['_ALTERACAOVEICULO']._serialized_start=774
+  _globals['_ALTERACAOVEICULO']._serialized_end=920
+  _globals['_DIASNOMERCADO']._serialized_start=922
+  _globals['_DIASNOMERCADO']._serialized_end=1007
+  _globals['_DIASNOMERCADOGRUPO']._serialized_start=1010
+  _globals['_DIASNOMERCADOGRUPO']._serialized_end=1148
+  _globals['_BIQUERYSERVICE']._serialized_start=1151
+  _globals['_BIQUERYSERVICE']._serialized_end=1578
 # @@protoc_insertion_point(module_scope)
@@ -49,6 +49,21 @@ class BIQueryServiceStub(object):
                 request_serializer=comunicacao__pb2.Filtro.SerializeToString,
                 response_deserializer=comunicacao__pb2.LocalizacaoStats.FromString,
                 _registered_method=True)
+        self.GetEstadoJob = channel.unary_unary(
+                '/comunicacao.BIQueryService/GetEstadoJob',
+                request_serializer=comunicacao__pb2.Filtro.SerializeToString,
+                response_deserializer=comunicacao__pb2.EstadoJob.FromString,
+                _registered_method=True)
+        self.GetVeiculoHistorico = channel.unary_unary(
+                '/comunicacao.BIQueryService/GetVeiculoHistorico',
+                request_serializer=comunicacao__pb2.Filtro.SerializeToString,
+                response_deserializer=comunicacao__pb2.VeiculoHistorico.FromString,
+                _registered_method=True)
+        self.GetDiasNoMercado = channel.unary_unary(
+                '/comunicacao.BIQueryService/GetDiasNoMercado',
+                request_serializer=comunicacao__pb2.Filtro.SerializeToString,
+                response_deserializer=comunicacao__pb2.DiasNoMercado.FromString,
+                _registered_method=True)
 
 
 class BIQueryServiceServicer(object):
@@ -72,6 +87,24 @@ class BIQueryServiceServicer(object):
         context.set_details('Method not implemented!')
         raise NotImplementedError('Method not implemented!')
 
+    def GetEstadoJob(self, request, context):
+        """Missing associated documentation comment in .proto file."""
+        context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+        context.set_details('Method not implemented!')
+        raise NotImplementedError('Method not implemented!')
+
+    def GetVeiculoHistorico(self, request, context):
+        """Missing associated documentation comment in .proto file."""
+        context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+        context.set_details('Method not implemented!')
+        raise NotImplementedError('Method not implemented!')
+
+    def GetDiasNoMercado(self, request, context):
+        """Missing associated documentation comment in .proto file."""
+        context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+        context.set_details('Method not implemented!')
+        raise NotImplementedError('Method not implemented!')
+
 
 def add_BIQueryServiceServicer_to_server(servicer, server):
     rpc_method_handlers = {
@@ -90,6 +123,21 @@ def add_BIQueryServiceServicer_to_server(servicer, server):
                     request_deserializer=comunicacao__pb2.Filtro.FromString,
                     response_serializer=comunicacao__pb2.LocalizacaoStats.SerializeToString,
             ),
+            'GetEstadoJob': grpc.unary_unary_rpc_method_handler(
+                    servicer.GetEstadoJob,
+                    request_deserializer=comunicacao__pb2.Filtro.FromString,
+                    response_serializer=comunicacao__pb2.EstadoJob.SerializeToString,
+            ),
+            'GetVeiculoHistorico': grpc.unary_unary_rpc_method_handler(
+                    servicer.GetVeiculoHistorico,
+                    request_deserializer=comunicacao__pb2.Filtro.FromString,
+                    response_serializer=comunicacao__pb2.VeiculoHistorico.SerializeToString,
+            ),
+            'GetDiasNoMercado': grpc.unary_unary_rpc_method_handler(
+                    servicer.GetDiasNoMercado,
+                    request_deserializer=comunicacao__pb2.Filtro.FromString,
+                    response_serializer=comunicacao__pb2.DiasNoMercado.SerializeToString,
+            ),
     }
     generic_handler = grpc.method_handlers_generic_handler(
             'comunicacao.BIQueryService', rpc_method_handlers)
@@ -181,3 +229,84 @@ class BIQueryService(object):
             timeout,
             metadata,
             _registered_method=True)
+
+    @staticmethod
+    def GetEstadoJob(request,
+            target,
+            options=(),
+            channel_credentials=None,
+            call_credentials=None,
+            insecure=False,
+            compression=None,
+            wait_for_ready=None,
+            timeout=None,
+            metadata=None):
+        return grpc.experimental.unary_unary(
+            request,
+            target,
+            '/comunicacao.BIQueryService/GetEstadoJob',
+            comunicacao__pb2.Filtro.SerializeToString,
+            comunicacao__pb2.EstadoJob.FromString,
+            options,
+            channel_credentials,
+            insecure,
+            call_credentials,
+            compression,
+            wait_for_ready,
+            timeout,
+            metadata,
+            _registered_method=True)
+
+    @staticmethod
+    def GetVeiculoHistorico(request,
+            target,
+            options=(),
+            channel_credentials=None,
+            call_credentials=None,
+            insecure=False,
+            compression=None,
+            wait_for_ready=None,
+            timeout=None,
+            metadata=None):
+        return grpc.experimental.unary_unary(
+            request,
+            target,
+            '/comunicacao.BIQueryService/GetVeiculoHistorico',
+            comunicacao__pb2.Filtro.SerializeToString,
+            comunicacao__pb2.VeiculoHistorico.FromString,
+            options,
+            channel_credentials,
+            insecure,
+            call_credentials,
+            compression,
+            wait_for_ready,
+            timeout,
+            metadata,
+            _registered_method=True)
+
+    @staticmethod
+    def GetDiasNoMercado(request,
+            target,
+            options=(),
+            channel_credentials=None,
+            call_credentials=None,
+            insecure=False,
+            compression=None,
+            wait_for_ready=None,
+            timeout=None,
+            metadata=None):
+        return grpc.experimental.unary_unary(
+            request,
+            target,
+            '/comunicacao.BIQueryService/GetDiasNoMercado',
+            comunicacao__pb2.Filtro.SerializeToString,
+            comunicacao__pb2.DiasNoMercado.FromString,
+            options,
+            channel_credentials,
+            insecure,
+            call_credentials,
+            compression,
+            wait_for_ready,
+            timeout,
+            metadata,
+            _registered_method=True)
@@ -6,6 +6,7 @@ const { Readable } = require('stream');
 const express = require('express');
 const FormData = require('form-data');
 const fs = require('fs');
+const crypto = require('crypto');
 
 const supabase = createClient(process.env.SUPABASE_URL, process.env.SUPABASE_KEY);
 const BUCKET_NAME = 'carros';
@@ -156,9 +157,54 @@ async function pollingBucket() {
 }
 
 const app = express();
-app.use(express.json());
+// Guardamos o corpo original para confirmar a assinatura HMAC do xml-service
+app.use(express.json({ verify: (req, res, buf) => { req.rawBody = buf; } }));
+
+// Mesma regra do pacote Go xml-service/assinatura: HMAC-SHA256(segredo, id + "." + timestamp + "." + corpo)
+const WEBHOOK_SECRET = process.env.WEBHOOK_SECRET;
+// Aceitar webhooks sem verificação tem de ser pedido explicitamente
+const WEBHOOK_SEM_ASSINATURA = process.env.WEBHOOK_SEM_ASSINATURA === 'true';
+const TOLERANCIA_WEBHOOK = 5 * 60; // segundos
+const entregasVistas = new Map();
+
+if (!WEBHOOK_SECRET) {
+    console.warn(WEBHOOK_SEM_ASSINATURA
+        ? "! WEBHOOK_SECRET não definido e WEBHOOK_SEM_ASSINATURA=true: os webhooks não são verificados"
+        : "! WEBHOOK_SECRET não definido: todos os webhooks vão ser rejeitados (WEBHOOK_SEM_ASSINATURA=true para não verificar)");
+}
+
+function webhookValido(req) {
+    if (!WEBHOOK_SECRET) return WEBHOOK_SEM_ASSINATURA;
+
+    const id = req.get('X-Webhook-Id');
+    const timestamp = req.get('X-Webhook-Timestamp');
+    const assinatura = req.get('X-Webhook-Signature') || '';
+    if (!id || !timestamp || !req.rawBody) return false;
+
+    const agora = Math.floor(Date.now() / 1000);
+    if (Math.abs(agora - Number(timestamp)) > TOLERANCIA_WEBHOOK) return false;
+
+    const esperada = 'sha256=' + crypto.createHmac('sha256', WEBHOOK_SECRET)
+        .update(`${id}.${timestamp}.`).update(req.rawBody).digest('hex');
+    if (esperada.length !== assinatura.length ||
+        !crypto.timingSafeEqual(Buffer.from(esperada), Buffer.from(assinatura))) return false;
+
+    // Replay: o mesmo id com o mesmo timestamp só é aceite uma vez (ambos fazem parte da assinatura)
+    for (const [chave, quando] of entregasVistas) {
+        if (agora - quando > 2 * TOLERANCIA_WEBHOOK) entregasVistas.delete(chave);
+    }
+    const chave = `${id}@${timestamp}`;
+    if (entregasVistas.has(chave)) return false;
+    entregasVistas.set(chave, agora);
+    return true;
+}
 
 app.post('/webhook', async (req, res) => {
+    if (!webhookValido(req)) {
+        console.error(`\n[WEBHOOK] Assinatura inválida, pedido ignorado`);
+        return res.sendStatus(401);
+    }
+
     const { requestId, status, fileName } = req.body;
     console.log(`\n[WEBHOOK] Recebido status ${status} para o pedido ${requestId}`);
     if (status === 'SUCCESS' || status === 'OK') {
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// chaveAnuncios serializa a comparação de cada upload com o stock anterior da mesma fonte
+const chaveAnuncios = 7203120
+
+// Estado do anúncio de um veículo, pelo último período em que esteve anunciado
+const (
+	AnuncioAtivo       = "ativo"
+	AnuncioRemovido    = "removido"    // Faltou no upload seguinte da fonte: provavelmente vendido
+	AnuncioReanunciado = "reanunciado" // Voltou a aparecer depois de ter sido removido
+)
+
+// Agrupamentos do relatório de dias no mercado
+const (
+	AgruparMarca    = "marca"
+	AgruparSegmento = "segmento"
+)
+
+// Expressão SQL do grupo de cada agrupamento, sobre a linha de veiculos do início do anúncio.
+// A marca é a primeira palavra da Designacao (o XML não tem um campo próprio).
+var expressaoAgrupamento = map[string]string{
+	AgruparMarca:    `COALESCE(NULLIF(upper(split_part(trim(v.designacao), ' ', 1)), ''), 'N/A')`,
+	AgruparSegmento: `COALESCE(NULLIF(trim(v.categoria), ''), 'N/A')`,
+}
+
+// DiasNoMercado resume quanto tempo os anúncios de um grupo (marca ou segmento) estiveram ativos
+type DiasNoMercado struct {
+	Grupo              string  `json:"grupo"`
+	Anuncios           int     `json:"anuncios"`
+	Ativos             int     `json:"ativos"`
+	Removidos          int     `json:"removidos"`
+	MediaDias          float64 `json:"mediaDias"`          // Anúncios ativos contam até agora
+	MediaDiasRemovidos float64 `json:"mediaDiasRemovidos"` // Só os anúncios já fechados
+}
+
+// registarAnuncios compara o documento com os anúncios abertos da mesma fonte: fecha os dos veículos
+// que faltam e abre os dos que apareceram (ou voltaram). Corre na transação do SaveXML, depois da projeção.
+// Um veículo que falta por ter sido rejeitado na validação continua anunciado; se alguma linha rejeitada
+// não tinha IDInterno, o documento não fecha nenhum anúncio.
+func registarAnuncios(tx *sql.Tx, documentoID int64) error {
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, chaveAnuncios); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(`
+		UPDATE anuncios a SET fim = d.data_criacao, documento_fim = d.id
+		FROM veiculos_xml d
+		WHERE d.id = $1 AND a.fonte = d.fonte AND a.fim IS NULL
+			AND d.rejeitadas_sem_id = 0 AND a.id_interno <> ALL (d.ids_rejeitados)
+			AND NOT EXISTS (SELECT 1 FROM veiculos v WHERE v.documento_id = d.id AND v.id_interno = a.id_interno)`, documentoID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO anuncios (fonte, id_interno, inicio, documento_inicio, reanuncio)
+		SELECT DISTINCT ON (v.id_interno) d.fonte, v.id_interno, d.data_criacao, d.id,
+			EXISTS (SELECT 1 FROM anuncios f WHERE f.fonte = d.fonte AND f.id_interno = v.id_interno)
+		FROM veiculos v
+		JOIN veiculos_xml d ON d.id = v.documento_id
+		WHERE d.id = $1
+			AND NOT EXISTS (SELECT 1 FROM anuncios a WHERE a.fonte = d.fonte AND a.id_interno = v.id_interno AND a.fim IS NULL)
+		ORDER BY v.id_interno`, documentoID)
+	return err
+}
+
+// GetEstadoAnuncio devolve o estado do veículo e a data em que lá chegou ("" se nunca foi anunciado).
+// Com várias fontes conta o anúncio mais recente.
+func GetEstadoAnuncio(db *sql.DB, idInterno string) (string, *time.Time, error) {
+	var inicio time.Time
+	var fim sql.NullTime
+	var reanuncio bool
+	query := `SELECT inicio, fim, reanuncio FROM anuncios WHERE id_interno = $1 ORDER BY fim IS NULL DESC, inicio DESC, id DESC LIMIT 1`
+	err := db.QueryRow(query, idInterno).Scan(&inicio, &fim, &reanuncio)
+	if err == sql.ErrNoRows {
+		return "", nil, nil
+	}
+	if err != nil {
+		log.Println("Erro ao ler estado do anúncio:", err)
+		return "", nil, err
+	}
+
+	switch {
+	case fim.Valid:
+		return AnuncioRemovido, &fim.Time, nil
+	case reanuncio:
+		return AnuncioReanunciado, &inicio, nil
+	default:
+		return AnuncioAtivo, &inicio, nil
+	}
+}
+
+// GetDiasNoMercado agrupa os anúncios por marca ou segmento e calcula os dias no mercado
+func GetDiasNoMercado(db *sql.DB, agrupamento string) ([]DiasNoMercado, error) {
+	grupo, ok := expressaoAgrupamento[agrupamento]
+	if !ok {
+		return nil, fmt.Errorf("agrupamento desconhecido: %s (marca ou segmento)", agrupamento)
+	}
+
+	query := `
+		SELECT
+			g.grupo,
+			COUNT(*),
+			COUNT(*) FILTER (WHERE a.fim IS NULL),
+			COUNT(*) FILTER (WHERE a.fim IS NOT NULL),
+			COALESCE(AVG(EXTRACT(EPOCH FROM COALESCE(a.fim, now()) - a.inicio) / 86400), 0),
+			COALESCE(AVG(EXTRACT(EPOCH FROM a.fim - a.inicio) / 86400) FILTER (WHERE a.fim IS NOT NULL), 0)
+		FROM anuncios a
+		CROSS JOIN LATERAL (
+			SELECT ` + grupo + ` AS grupo
+			FROM veiculos v
+			WHERE v.documento_id = a.documento_inicio AND v.id_interno = a.id_interno
+			LIMIT 1
+		) g
+		GROUP BY g.grupo
+		ORDER BY g.grupo`
+	rows, err := db.Query(query)
+	if err != nil {
+		log.Println("Erro ao calcular dias no mercado:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	grupos := []DiasNoMercado{}
+	for rows.Next() {
+		var d DiasNoMercado
+		if err := rows.Scan(&d.Grupo, &d.Anuncios, &d.Ativos, &d.Removidos, &d.MediaDias, &d.MediaDiasRemovidos); err != nil {
+			log.Println("Erro ao ler dias no mercado:", err)
+			return nil, err
+		}
+		grupos = append(grupos, d)
+	}
+	return grupos, rows.Err()
+}
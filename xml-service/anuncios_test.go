@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestAnunciosUploadParcial(t *testing.T) {
+	db := bdTeste(t)
+
+	a := veiculoTeste{id: "A", designacao: "Fiat 500", preco: "9000", kms: "40000", cidade: "Faro"}
+	b := veiculoTeste{id: "B", designacao: "Fiat Panda", preco: "7000", kms: "90000", cidade: "Faro"}
+	c := veiculoTeste{id: "C", designacao: "Fiat Tipo", preco: "12000", kms: "20000", cidade: "Faro"}
+	guardarDocumento(t, db, "anuncios-1", a, b, c)
+
+	estados := map[string]string{}
+	verificar := func(etapa string) {
+		t.Helper()
+		for id, esperado := range estados {
+			estado, _, err := GetEstadoAnuncio(db, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if estado != esperado {
+				t.Errorf("%s: anúncio de %s %q, esperado %q", etapa, id, estado, esperado)
+			}
+		}
+	}
+
+	// B foi rejeitado na validação: falta no Stock mas continua à venda. C faltou mesmo.
+	guardarParcial(t, db, "anuncios-2", Rejeitados{IDs: []string{"B"}}, a)
+	estados["A"], estados["B"], estados["C"] = AnuncioAtivo, AnuncioAtivo, AnuncioRemovido
+	verificar("rejeitado com IDInterno")
+
+	// Uma linha rejeitada sem IDInterno pode ser qualquer um dos veículos em falta
+	guardarParcial(t, db, "anuncios-3", Rejeitados{SemID: 1}, a)
+	verificar("rejeitado sem IDInterno")
+
+	// Num upload completo, B falta de facto
+	guardarDocumento(t, db, "anuncios-4", a)
+	estados["B"] = AnuncioRemovido
+	verificar("upload completo")
+
+	if _, _, err := ReconstruirVeiculos(db); err != nil {
+		t.Fatal(err)
+	}
+	verificar("reconstrução")
+}
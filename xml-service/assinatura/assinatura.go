@@ -0,0 +1,131 @@
+// Package assinatura assina e verifica os webhooks enviados pelo xml-service.
+//
+// Cada entrega leva três cabeçalhos:
+//
+//	X-Webhook-Id         identificador único da entrega (repete-se nas novas tentativas)
+//	X-Webhook-Timestamp  segundos Unix do momento do envio
+//	X-Webhook-Signature  "sha256=" + HMAC-SHA256(segredo, id + "." + timestamp + "." + corpo) em hexadecimal
+//
+// Quem recebe deve recalcular a assinatura com o segredo partilhado, rejeitar timestamps
+// fora da tolerância e ignorar pedidos já vistos (proteção contra replay). O id entra na assinatura
+// para que uma entrega capturada não possa ser repetida com outro id. As novas tentativas
+// de uma mesma entrega mantêm o id mas levam um timestamp novo.
+//
+// Um segredo vazio não verifica nada, por isso é rejeitado: quem não quer verificar não chama Verificar.
+package assinatura
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CabecalhoId         = "X-Webhook-Id"
+	CabecalhoTimestamp  = "X-Webhook-Timestamp"
+	CabecalhoAssinatura = "X-Webhook-Signature"
+
+	prefixo = "sha256="
+)
+
+var (
+	ErrAssinaturaInvalida = errors.New("assinatura do webhook inválida")
+	ErrTimestampInvalido  = errors.New("timestamp do webhook inválido ou fora da tolerância")
+	ErrReplay             = errors.New("entrega de webhook repetida")
+	ErrSemSegredo         = errors.New("segredo do webhook não configurado")
+)
+
+// Assinar devolve o valor do cabeçalho X-Webhook-Signature para a entrega, timestamp e corpo dados
+func Assinar(segredo []byte, id string, timestamp int64, corpo []byte) string {
+	mac := hmac.New(sha256.New, segredo)
+	mac.Write([]byte(id))
+	mac.Write([]byte("."))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(corpo)
+	return prefixo + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verificar confirma a assinatura e que o timestamp está dentro da tolerância em relação a agora
+func Verificar(segredo []byte, assinatura string, id string, timestamp string, corpo []byte, tolerancia time.Duration, agora time.Time) error {
+	if len(segredo) == 0 {
+		return ErrSemSegredo
+	}
+	if id == "" {
+		return ErrAssinaturaInvalida
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrTimestampInvalido
+	}
+	diferenca := agora.Sub(time.Unix(ts, 0))
+	if diferenca < -tolerancia || diferenca > tolerancia {
+		return ErrTimestampInvalido
+	}
+
+	if !strings.HasPrefix(assinatura, prefixo) {
+		return ErrAssinaturaInvalida
+	}
+	esperada := Assinar(segredo, id, ts, corpo)
+	if !hmac.Equal([]byte(esperada), []byte(assinatura)) {
+		return ErrAssinaturaInvalida
+	}
+	return nil
+}
+
+// Verificador valida pedidos HTTP de webhook e lembra-se dos pares (id, timestamp) já aceites
+// durante a janela de tolerância, para rejeitar replays. Os dois entram na assinatura, por isso
+// não podem ser trocados sem a invalidar. Pode ser criado com NovoVerificador ou diretamente,
+// preenchendo Segredo e Tolerancia.
+type Verificador struct {
+	Segredo    []byte
+	Tolerancia time.Duration
+
+	mu     sync.Mutex
+	vistos map[string]time.Time
+}
+
+// NovoVerificador cria um verificador com o segredo partilhado e a tolerância de relógio
+func NovoVerificador(segredo []byte, tolerancia time.Duration) *Verificador {
+	return &Verificador{Segredo: segredo, Tolerancia: tolerancia, vistos: map[string]time.Time{}}
+}
+
+// VerificarPedido lê o corpo do pedido, valida os cabeçalhos e devolve o corpo para ser processado
+func (v *Verificador) VerificarPedido(r *http.Request) ([]byte, error) {
+	corpo, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	agora := time.Now()
+	id := r.Header.Get(CabecalhoId)
+	err = Verificar(v.Segredo, r.Header.Get(CabecalhoAssinatura), id, r.Header.Get(CabecalhoTimestamp), corpo, v.Tolerancia, agora)
+	if err != nil {
+		return nil, err
+	}
+
+	chave := id + "@" + r.Header.Get(CabecalhoTimestamp)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.vistos == nil {
+		v.vistos = map[string]time.Time{}
+	}
+	for visto, quando := range v.vistos {
+		if agora.Sub(quando) > 2*v.Tolerancia {
+			delete(v.vistos, visto)
+		}
+	}
+	if _, repetido := v.vistos[chave]; repetido {
+		return nil, ErrReplay
+	}
+	v.vistos[chave] = agora
+	return corpo, nil
+}
@@ -0,0 +1,103 @@
+package assinatura
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var segredoTeste = []byte("segredo-partilhado")
+
+func TestAssinarVerificar(t *testing.T) {
+	agora := time.Unix(1_700_000_000, 0)
+	corpo := []byte(`{"requestId":"abc","status":"SUCCESS"}`)
+	ts := strconv.FormatInt(agora.Unix(), 10)
+	assinatura := Assinar(segredoTeste, "entrega-1", agora.Unix(), corpo)
+
+	if !strings.HasPrefix(assinatura, "sha256=") || len(assinatura) != len("sha256=")+64 {
+		t.Fatalf("assinatura com formato inesperado: %s", assinatura)
+	}
+
+	casos := []struct {
+		nome       string
+		segredo    []byte
+		assinatura string
+		id         string
+		timestamp  string
+		corpo      []byte
+		agora      time.Time
+		erro       error
+	}{
+		{"válida", segredoTeste, assinatura, "entrega-1", ts, corpo, agora, nil},
+		{"dentro da tolerância", segredoTeste, assinatura, "entrega-1", ts, corpo, agora.Add(4 * time.Minute), nil},
+		{"segredo errado", []byte("outro"), assinatura, "entrega-1", ts, corpo, agora, ErrAssinaturaInvalida},
+		{"sem segredo", nil, assinatura, "entrega-1", ts, corpo, agora, ErrSemSegredo},
+		{"corpo alterado", segredoTeste, assinatura, "entrega-1", ts, []byte(`{"requestId":"xyz"}`), agora, ErrAssinaturaInvalida},
+		{"id trocado", segredoTeste, assinatura, "entrega-2", ts, corpo, agora, ErrAssinaturaInvalida},
+		{"sem id", segredoTeste, assinatura, "", ts, corpo, agora, ErrAssinaturaInvalida},
+		{"sem prefixo", segredoTeste, strings.TrimPrefix(assinatura, "sha256="), "entrega-1", ts, corpo, agora, ErrAssinaturaInvalida},
+		{"timestamp expirado", segredoTeste, assinatura, "entrega-1", ts, corpo, agora.Add(6 * time.Minute), ErrTimestampInvalido},
+		{"timestamp no futuro", segredoTeste, assinatura, "entrega-1", ts, corpo, agora.Add(-6 * time.Minute), ErrTimestampInvalido},
+		{"timestamp inválido", segredoTeste, assinatura, "entrega-1", "ontem", corpo, agora, ErrTimestampInvalido},
+	}
+	for _, c := range casos {
+		err := Verificar(c.segredo, c.assinatura, c.id, c.timestamp, c.corpo, 5*time.Minute, c.agora)
+		if !errors.Is(err, c.erro) {
+			t.Errorf("%s: erro %v, esperado %v", c.nome, err, c.erro)
+		}
+	}
+}
+
+// pedidoAssinado simula uma entrega do xml-service com o timestamp dado
+func pedidoAssinado(id string, ts int64, corpo string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(corpo))
+	r.Header.Set(CabecalhoId, id)
+	r.Header.Set(CabecalhoTimestamp, strconv.FormatInt(ts, 10))
+	r.Header.Set(CabecalhoAssinatura, Assinar(segredoTeste, id, ts, []byte(corpo)))
+	return r
+}
+
+func TestVerificarPedido(t *testing.T) {
+	v := NovoVerificador(segredoTeste, 5*time.Minute)
+	agora := time.Now().Unix()
+
+	corpo, err := v.VerificarPedido(pedidoAssinado("entrega-1", agora, `{"n":1}`))
+	if err != nil || string(corpo) != `{"n":1}` {
+		t.Fatalf("primeira entrega: %q, %v", corpo, err)
+	}
+
+	// O mesmo pedido outra vez é um replay
+	if _, err := v.VerificarPedido(pedidoAssinado("entrega-1", agora, `{"n":1}`)); !errors.Is(err, ErrReplay) {
+		t.Errorf("replay: erro %v, esperado %v", err, ErrReplay)
+	}
+	// Uma nova tentativa da mesma entrega leva outro timestamp e é aceite
+	if _, err := v.VerificarPedido(pedidoAssinado("entrega-1", agora+1, `{"n":1}`)); err != nil {
+		t.Errorf("nova tentativa: %v", err)
+	}
+	// Outra entrega no mesmo segundo não é confundida com um replay
+	if _, err := v.VerificarPedido(pedidoAssinado("entrega-2", agora, `{"n":2}`)); err != nil {
+		t.Errorf("outra entrega: %v", err)
+	}
+
+	// Um pedido expirado é rejeitado antes de chegar à cache de replays
+	antigo := time.Now().Add(-time.Hour).Unix()
+	if _, err := v.VerificarPedido(pedidoAssinado("entrega-3", antigo, `{}`)); !errors.Is(err, ErrTimestampInvalido) {
+		t.Errorf("expirado: erro %v, esperado %v", err, ErrTimestampInvalido)
+	}
+}
+
+// Um Verificador construído sem NovoVerificador também funciona
+func TestVerificadorLiteral(t *testing.T) {
+	v := &Verificador{Segredo: segredoTeste, Tolerancia: time.Minute}
+	agora := time.Now().Unix()
+	if _, err := v.VerificarPedido(pedidoAssinado("entrega-1", agora, `{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.VerificarPedido(pedidoAssinado("entrega-1", agora, `{}`)); !errors.Is(err, ErrReplay) {
+		t.Errorf("replay: erro %v, esperado %v", err, ErrReplay)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ColunaCSV descreve um campo lógico do CSV enviado pelo processor.
+// O cabeçalho é comparado com o Nome e com os Aliases (sem distinguir maiúsculas).
+type ColunaCSV struct {
+	Nome        string
+	Aliases     []string
+	Obrigatoria bool
+}
+
+// aliasesCSV devolve os aliases extra definidos em CSV_ALIASES, por nome de coluna.
+// Formato: "Preco=price|valor;Cidade=city"
+func aliasesCSV() map[string][]string {
+	extra := map[string][]string{}
+	cfg := os.Getenv("CSV_ALIASES")
+	if cfg == "" {
+		return extra
+	}
+	for _, entrada := range strings.Split(cfg, ";") {
+		partes := strings.SplitN(entrada, "=", 2)
+		if len(partes) != 2 {
+			continue
+		}
+		nome := normalizarCabecalho(partes[0])
+		for _, a := range strings.Split(partes[1], "|") {
+			if a = strings.TrimSpace(a); a != "" {
+				extra[nome] = append(extra[nome], a)
+			}
+		}
+	}
+	return extra
+}
+
+// MapaColunas guarda, para cada campo lógico, o índice da coluna no CSV
+type MapaColunas map[string]int
+
+func normalizarCabecalho(s string) string {
+	return strings.ToLower(strings.TrimSpace(strings.TrimPrefix(s, "\ufeff")))
+}
+
+// mapearCabecalho resolve o cabeçalho do CSV para as colunas pedidas.
+// Devolve erro com a lista de colunas obrigatórias que não foram encontradas.
+func mapearCabecalho(colunas []ColunaCSV, cabecalho []string) (MapaColunas, error) {
+	indices := make(map[string]int, len(cabecalho))
+	for i, h := range cabecalho {
+		h = normalizarCabecalho(h)
+		if _, existe := indices[h]; !existe {
+			indices[h] = i
+		}
+	}
+
+	mapa := MapaColunas{}
+	var emFalta []string
+	for _, c := range colunas {
+		encontrado := false
+		for _, nome := range append([]string{c.Nome}, c.Aliases...) {
+			if i, ok := indices[normalizarCabecalho(nome)]; ok {
+				mapa[c.Nome] = i
+				encontrado = true
+				break
+			}
+		}
+		if !encontrado && c.Obrigatoria {
+			emFalta = append(emFalta, c.Nome)
+		}
+	}
+
+	if len(emFalta) > 0 {
+		return nil, fmt.Errorf("colunas obrigatórias em falta: %s", strings.Join(emFalta, ", "))
+	}
+	return mapa, nil
+}
+
+// valor devolve o conteúdo da coluna do campo, ou "" se a coluna não existir na linha
+func (m MapaColunas) valor(linha []string, campo string) string {
+	i, ok := m[campo]
+	if !ok || i >= len(linha) {
+		return ""
+	}
+	return linha[i]
+}
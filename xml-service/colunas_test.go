@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMapearCabecalho(t *testing.T) {
+	colunas := []ColunaCSV{
+		{Nome: "Identificador", Aliases: []string{"IDInterno", "id_externo"}, Obrigatoria: true},
+		{Nome: "Preco", Aliases: []string{"preco_eur"}, Obrigatoria: true},
+		{Nome: "Cidade", Aliases: []string{"localidade"}},
+	}
+
+	casos := []struct {
+		nome      string
+		cabecalho []string
+		esperado  MapaColunas
+		emFalta   string
+	}{
+		{"nomes", []string{"Identificador", "Preco", "Cidade"}, MapaColunas{"Identificador": 0, "Preco": 1, "Cidade": 2}, ""},
+		{"ordem trocada", []string{"Cidade", "Preco", "Identificador"}, MapaColunas{"Identificador": 2, "Preco": 1, "Cidade": 0}, ""},
+		{"aliases", []string{"id_externo", "localidade", "preco_eur"}, MapaColunas{"Identificador": 0, "Preco": 2, "Cidade": 1}, ""},
+		{"maiúsculas, espaços e BOM", []string{"\ufeffIDINTERNO", " preco ", "CIDADE"}, MapaColunas{"Identificador": 0, "Preco": 1, "Cidade": 2}, ""},
+		{"nome antes do alias", []string{"IDInterno", "Identificador", "Preco"}, MapaColunas{"Identificador": 1, "Preco": 2}, ""},
+		{"coluna repetida conta a primeira", []string{"Identificador", "Preco", "preco"}, MapaColunas{"Identificador": 0, "Preco": 1}, ""},
+		{"opcional em falta", []string{"Identificador", "Preco"}, MapaColunas{"Identificador": 0, "Preco": 1}, ""},
+		{"obrigatória em falta", []string{"Identificador", "Cidade"}, nil, "Preco"},
+		{"várias obrigatórias em falta", []string{"Cidade"}, nil, "Identificador, Preco"},
+	}
+	for _, c := range casos {
+		mapa, err := mapearCabecalho(colunas, c.cabecalho)
+		if c.emFalta != "" {
+			if err == nil || !strings.HasSuffix(err.Error(), ": "+c.emFalta) {
+				t.Errorf("%s: erro %v, esperadas em falta %s", c.nome, err, c.emFalta)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.nome, err)
+			continue
+		}
+		if len(mapa) != len(c.esperado) {
+			t.Errorf("%s: %v, esperado %v", c.nome, mapa, c.esperado)
+			continue
+		}
+		for campo, i := range c.esperado {
+			if j, ok := mapa[campo]; !ok || j != i {
+				t.Errorf("%s: %v, esperado %v", c.nome, mapa, c.esperado)
+				break
+			}
+		}
+	}
+}
+
+func TestAliasesCSV(t *testing.T) {
+	t.Setenv("CSV_ALIASES", "Preco=price| valor ;Cidade=city;invalido;Ano=")
+	extra := aliasesCSV()
+	if got := strings.Join(extra["preco"], ","); got != "price,valor" {
+		t.Errorf("aliases de Preco: %q", got)
+	}
+	if got := strings.Join(extra["cidade"], ","); got != "city" {
+		t.Errorf("aliases de Cidade: %q", got)
+	}
+	if len(extra) != 2 {
+		t.Errorf("aliases: %v, esperados só Preco e Cidade", extra)
+	}
+}
+
+func TestMapaColunasValor(t *testing.T) {
+	mapa := MapaColunas{"Preco": 1, "Cidade": 5}
+	linha := []string{"A1", "12000"}
+	if v := mapa.valor(linha, "Preco"); v != "12000" {
+		t.Errorf("Preco: %q", v)
+	}
+	// Linha mais curta do que o cabeçalho e campo sem coluna
+	if v := mapa.valor(linha, "Cidade"); v != "" {
+		t.Errorf("Cidade: %q", v)
+	}
+	if v := mapa.valor(linha, "Ano"); v != "" {
+		t.Errorf("Ano: %q", v)
+	}
+}
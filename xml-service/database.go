@@ -2,12 +2,13 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 func ConnectDB() *sql.DB {
@@ -27,100 +28,184 @@ func ConnectDB() *sql.DB {
 }
 
 
-func SaveXML(db *sql.DB, xmlDoc string, mapperVer string) error {
-	query := `INSERT INTO veiculos_xml (xml_documento, data_criacao, mapper_version) VALUES ($1, $2, $3)`
-	_, err := db.Exec(query, xmlDoc, time.Now(), mapperVer)
+// SaveXML guarda o documento, com a versão do XSD contra a qual foi validado, e devolve o id
+// atribuído pela base de dados. Os veículos do documento entram na tabela veiculos, no histórico e
+// nos anúncios da fonte na mesma transação. rejeitados são as linhas que a validação deixou fora do XML.
+func SaveXML(db *sql.DB, reqID string, xmlDoc string, mapperVer string, versaoXSD string, fonte string, rejeitados Rejeitados) (int64, error) {
+	tx, err := db.Begin()
 	if err != nil {
 		log.Println("Erro ao inserir XML:", err)
-		return err
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	agora := time.Now()
+	query := `INSERT INTO veiculos_xml (request_id, xml_documento, data_criacao, mapper_version, versao_xsd, fonte, ids_rejeitados, rejeitadas_sem_id)
+		VALUES ($1, $2, $3, $4, $5, $6, COALESCE($7, '{}'::text[]), $8) RETURNING id`
+	err = tx.QueryRow(query, reqID, xmlDoc, agora, mapperVer, versaoXSD, fonte, pq.Array(rejeitados.IDs), rejeitados.SemID).Scan(&id)
+	if err != nil {
+		log.Println("Erro ao inserir XML:", err)
+		return 0, err
+	}
+	// O hash é do XML tal como o PostgreSQL o devolve, que é o que GET /documentos/{id}/xml serve (ETag)
+	if _, err := tx.Exec(`UPDATE veiculos_xml SET xml_sha256 = encode(sha256(convert_to(xml_documento::text, 'UTF8')), 'hex') WHERE id = $1`, id); err != nil {
+		log.Println("Erro ao inserir XML:", err)
+		return 0, err
+	}
+	if _, err := projetarVeiculos(tx, id); err != nil {
+		log.Println("Erro ao projetar veículos:", err)
+		return 0, err
+	}
+	if err := atualizarVeiculosAtuais(tx, id); err != nil {
+		log.Println("Erro ao atualizar veículos atuais:", err)
+		return 0, err
+	}
+	if err := registarHistorico(tx, id); err != nil {
+		log.Println("Erro ao registar histórico dos veículos:", err)
+		return 0, err
+	}
+	if err := registarAnuncios(tx, id); err != nil {
+		log.Println("Erro ao atualizar anúncios:", err)
+		return 0, err
+	}
+	// O job fica com o documento na mesma transação: se o worker cair a seguir, a nova tentativa não o guarda outra vez
+	if _, err := tx.Exec(`UPDATE jobs SET documento_id = $2, data_atualizacao = $3 WHERE request_id = $1`, reqID, id, agora); err != nil {
+		log.Println("Erro ao associar documento ao job:", err)
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Erro ao inserir XML:", err)
+		return 0, err
 	}
 	log.Println("XML guardado na base de dados local.")
+	return id, nil
+}
+
+
+// SaveRelatorioValidacao guarda o relatório de validação linha a linha do pedido
+func SaveRelatorioValidacao(db *sql.DB, reqID string, fileName string, rel *RelatorioValidacao) error {
+	erros, _ := json.Marshal(rel.Erros)
+	veiculos, _ := json.Marshal(rel.Veiculos)
+	query := `INSERT INTO relatorios_validacao (request_id, file_name, resultado, linhas_lidas, linhas_aceites, linhas_rejeitadas, erros, veiculos, data_criacao)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err := db.Exec(query, reqID, fileName, rel.Resultado, rel.LinhasLidas, rel.LinhasAceites, rel.LinhasRejeitadas, string(erros), string(veiculos), time.Now())
+	if err != nil {
+		log.Println("Erro ao guardar relatório de validação:", err)
+		return err
+	}
+	return nil
+}
+
+// SaveErrosDocumento junta ao relatório de validação do pedido os erros encontrados pelo XSD
+// e pelo Schematron (uma lista vazia não altera o que já estava guardado)
+func SaveErrosDocumento(db *sql.DB, reqID string, errosXSD []ErroDocumento, errosSchematron []ErroDocumento) error {
+	var xsd, sch sql.NullString
+	if len(errosXSD) > 0 {
+		dados, _ := json.Marshal(errosXSD)
+		xsd = sql.NullString{String: string(dados), Valid: true}
+	}
+	if len(errosSchematron) > 0 {
+		dados, _ := json.Marshal(errosSchematron)
+		sch = sql.NullString{String: string(dados), Valid: true}
+	}
+	query := `UPDATE relatorios_validacao SET erros_xsd = COALESCE($2, erros_xsd), erros_schematron = COALESCE($3, erros_schematron)
+		WHERE request_id = $1 AND data_criacao = (SELECT MAX(data_criacao) FROM relatorios_validacao WHERE request_id = $1)`
+	_, err := db.Exec(query, reqID, xsd, sch)
+	if err != nil {
+		log.Println("Erro ao guardar erros do documento:", err)
+		return err
+	}
 	return nil
 }
 
+// GetRelatorioValidacao lê o relatório de validação do pedido (nil se não existir)
+func GetRelatorioValidacao(db *sql.DB, reqID string) *RelatorioValidacao {
+	rel := &RelatorioValidacao{}
+	var erros, errosXSD, errosSchematron, veiculos []byte
+	query := `SELECT resultado, linhas_lidas, linhas_aceites, linhas_rejeitadas, erros, erros_xsd, erros_schematron, veiculos
+		FROM relatorios_validacao WHERE request_id = $1 ORDER BY data_criacao DESC LIMIT 1`
+	err := db.QueryRow(query, reqID).Scan(&rel.Resultado, &rel.LinhasLidas, &rel.LinhasAceites, &rel.LinhasRejeitadas, &erros, &errosXSD, &errosSchematron, &veiculos)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Println("Erro ao ler relatório de validação:", err)
+		}
+		return nil
+	}
+	json.Unmarshal(erros, &rel.Erros)
+	if errosXSD != nil {
+		json.Unmarshal(errosXSD, &rel.ErrosXSD)
+	}
+	if errosSchematron != nil {
+		json.Unmarshal(errosSchematron, &rel.ErrosSchematron)
+	}
+	if veiculos != nil {
+		json.Unmarshal(veiculos, &rel.Veiculos)
+	}
+	return rel
+}
 
-func GetMarcaStatsXPath(db *sql.DB, marca string) (int32, float32, float32) {
+
+// GetMarcaStats lê a projeção veiculos; um IDInterno presente em vários documentos conta uma vez,
+// com a observação que a política escolheu em veiculos_atuais (ver PoliticaVeiculos). apenasAtivos conta só o stock
+// com anúncio aberto.
+func GetMarcaStats(db *sql.DB, politica PoliticaVeiculos, apenasAtivos bool, marca string) (int32, float32, float32) {
 	var total int32
 	var mPreco, mKms sql.NullFloat64
 
+	// A política escolhe primeiro a observação de cada veículo e só depois se filtra,
+	// para que um veículo cuja designação mudou não conte pela versão antiga
 	query := `
-		WITH v_table AS (
-			SELECT 
-				unnest(xpath('/RelatorioVeiculos/Stock/Veiculo/@IDInterno', xml_documento))::text as id_interno,
-				unnest(xpath('/RelatorioVeiculos/Stock/Veiculo/Identificacao/Designacao/text()', xml_documento))::text as designacao,
-				unnest(xpath('/RelatorioVeiculos/Stock/Veiculo/Identificacao/Preco/text()', xml_documento))::text::numeric as preco,
-				unnest(xpath('/RelatorioVeiculos/Stock/Veiculo/HistoricoUso/Kilometragem/text()', xml_documento))::text::numeric as kms
-			FROM veiculos_xml
-		),
-		deduplicated AS (
-			-- DISTINCT ON garante que se o mesmo IDInterno aparecer em vários XMLs, só contamos uma vez
-			SELECT DISTINCT ON (id_interno) id_interno, designacao, preco, kms
-			FROM v_table
-			WHERE designacao ILIKE $1
-		)
+		WITH ` + politica.observacoes(apenasAtivos) + `
 		SELECT 
 			COUNT(*),
 			COALESCE(AVG(preco), 0),
 			COALESCE(AVG(kms), 0)
-		FROM deduplicated`
+		FROM observacoes
+		WHERE designacao ILIKE $1`
 	
 	err := db.QueryRow(query, "%"+marca+"%").Scan(&total, &mPreco, &mKms)
 	if err != nil {
-		log.Println("Erro XPath Marca:", err)
+		log.Println("Erro estatísticas Marca:", err)
 		return 0, 0, 0
 	}
 	return total, float32(mPreco.Float64), float32(mKms.Float64)
 }
 
 
-func GetCountSegmentoXPath(db *sql.DB, segmento string) int32 {
+func GetCountSegmento(db *sql.DB, politica PoliticaVeiculos, apenasAtivos bool, segmento string) int32 {
 	var total int32
 	query := `
-		WITH v_table AS (
-			SELECT 
-				unnest(xpath('/RelatorioVeiculos/Stock/Veiculo/@IDInterno', xml_documento))::text as id_interno,
-				unnest(xpath('/RelatorioVeiculos/Stock/Veiculo/Identificacao/Categoria/text()', xml_documento))::text as cat
-			FROM veiculos_xml
-		)
-		SELECT COUNT(DISTINCT id_interno) 
-		FROM v_table 
-		WHERE cat ILIKE $1`
+		WITH ` + politica.observacoes(apenasAtivos) + `
+		SELECT COUNT(*) 
+		FROM observacoes 
+		WHERE categoria ILIKE $1`
 	
 	err := db.QueryRow(query, "%"+segmento+"%").Scan(&total)
 	if err != nil {
-		log.Println("Erro XPath Segmento:", err)
+		log.Println("Erro estatísticas Segmento:", err)
 		return 0
 	}
 	return total
 }
 
 
-func GetLocalizacaoStatsXPath(db *sql.DB, cidade string) (int32, float32) {
+func GetLocalizacaoStats(db *sql.DB, politica PoliticaVeiculos, apenasAtivos bool, cidade string) (int32, float32) {
 	var total int32
 	var valorTotal sql.NullFloat64
 
 	query := `
-		WITH v_table AS (
-			SELECT 
-				unnest(xpath('/RelatorioVeiculos/Stock/Veiculo/@IDInterno', xml_documento))::text as id_interno,
-				unnest(xpath('/RelatorioVeiculos/Stock/Veiculo/Geografia/Cidade/text()', xml_documento))::text as cidade_nome,
-				unnest(xpath('/RelatorioVeiculos/Stock/Veiculo/Identificacao/Preco/text()', xml_documento))::text::numeric as preco
-			FROM veiculos_xml
-		),
-		deduplicated AS (
-			SELECT DISTINCT ON (id_interno) id_interno, cidade_nome, preco
-			FROM v_table
-			WHERE cidade_nome ILIKE $1
-		)
+		WITH ` + politica.observacoes(apenasAtivos) + `
 		SELECT 
 			COUNT(*),
 			COALESCE(SUM(preco), 0)
-		FROM deduplicated`
+		FROM observacoes
+		WHERE cidade ILIKE $1`
 
 	err := db.QueryRow(query, "%"+cidade+"%").Scan(&total, &valorTotal)
 	if err != nil {
-		log.Println("Erro XPath Localidade:", err)
+		log.Println("Erro estatísticas Localidade:", err)
 		return 0, 0
 	}
 	return total, float32(valorTotal.Float64)
-}
\ No newline at end of file
+}
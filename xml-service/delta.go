@@ -0,0 +1,331 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/libxml2"
+	"github.com/lib/pq"
+)
+
+// Sentido de uma alteração num campo numérico
+const (
+	SentidoSubiu  = "subiu"
+	SentidoDesceu = "desceu"
+)
+
+// Campos comparados entre os dois documentos, pelo caminho XML (ver valoresVeiculo)
+var camposDelta = []string{
+	"Identificacao/Preco",
+	"HistoricoUso/Kilometragem",
+	"Identificacao/Designacao",
+	"Identificacao/Ano",
+	"Identificacao/Categoria",
+	"DetalhesTecnicos/Cilindrada",
+	"DetalhesTecnicos/PotenciaMotor",
+	"DetalhesTecnicos/TipoCombustivel",
+	"DetalhesTecnicos/TipoTransmissao",
+	"Geografia/Cidade",
+	"Geografia/PosicionamentoGPS/@Lat",
+	"Geografia/PosicionamentoGPS/@Lon",
+}
+
+// RelatorioDelta são as diferenças entre um documento e o anterior da mesma fonte.
+// Sem documento anterior, todos os veículos aparecem como adicionados.
+type RelatorioDelta struct {
+	XMLName             xml.Name          `xml:"RelatorioDelta" json:"-"`
+	DocumentoId         int64             `xml:"DocumentoId,attr" json:"documentoId"`
+	DocumentoAnteriorId int64             `xml:"DocumentoAnteriorId,attr,omitempty" json:"documentoAnteriorId,omitempty"`
+	Fonte               string            `xml:"Fonte,attr" json:"fonte"`
+	DataGeracao         string            `xml:"DataGeracao,attr" json:"dataGeracao"`
+	Resumo              ResumoDelta       `xml:"Resumo" json:"resumo"`
+	Adicionados         []VeiculoDelta    `xml:"Adicionados>Veiculo" json:"adicionados"`
+	Removidos           []VeiculoDelta    `xml:"Removidos>Veiculo" json:"removidos"`
+	Alterados           []VeiculoAlterado `xml:"Alterados>Veiculo" json:"alterados"`
+}
+
+// ResumoDelta são as contagens do delta, também enviadas no webhook
+type ResumoDelta struct {
+	Adicionados int `xml:"Adicionados,attr" json:"adicionados"`
+	Removidos   int `xml:"Removidos,attr" json:"removidos"`
+	Alterados   int `xml:"Alterados,attr" json:"alterados"`
+	PrecoSubiu  int `xml:"PrecoSubiu,attr" json:"precoSubiu"`
+	PrecoDesceu int `xml:"PrecoDesceu,attr" json:"precoDesceu"`
+	KmAlterados int `xml:"KmAlterados,attr" json:"kmAlterados"`
+}
+
+// VeiculoDelta é um veículo que entrou ou saiu do stock
+type VeiculoDelta struct {
+	IDInterno  string    `xml:"IDInterno,attr" json:"idInterno"`
+	Designacao string    `xml:"Designacao,attr,omitempty" json:"designacao,omitempty"`
+	Preco      numeroXML `xml:"Preco,attr" json:"preco"`
+}
+
+// VeiculoAlterado é um veículo presente nos dois documentos com pelo menos um campo diferente
+type VeiculoAlterado struct {
+	IDInterno  string           `xml:"IDInterno,attr" json:"idInterno"`
+	Designacao string           `xml:"Designacao,attr,omitempty" json:"designacao,omitempty"`
+	Alteracoes []AlteracaoCampo `xml:"Alteracao" json:"alteracoes"`
+}
+
+// AlteracaoCampo é um campo que mudou; Sentido só existe nos campos numéricos
+type AlteracaoCampo struct {
+	Campo    string `xml:"Campo,attr" json:"campo"`
+	Anterior string `xml:"Anterior,attr" json:"anterior"`
+	Novo     string `xml:"Novo,attr" json:"novo"`
+	Sentido  string `xml:"Sentido,attr,omitempty" json:"sentido,omitempty"`
+}
+
+// CalcularDelta compara o stock atual com o anterior (nil se for o primeiro upload da fonte).
+// Os veículos rejeitados na validação do upload atual não contam como removidos; se alguma linha
+// rejeitada não tinha IDInterno, não se sabe quais faltam de facto e o delta fica sem removidos.
+// Do mesmo modo, um veículo rejeitado no upload anterior (rejeitadosAnterior) já estava no stock da
+// fonte e não conta como adicionado. Um IDInterno repetido conta pela primeira ocorrência.
+func CalcularDelta(documentoID int64, anteriorID int64, fonte string, anterior *ListaVeiculos, atual *ListaVeiculos, rejeitados Rejeitados, rejeitadosAnterior Rejeitados) *RelatorioDelta {
+	d := &RelatorioDelta{
+		DocumentoId:         documentoID,
+		DocumentoAnteriorId: anteriorID,
+		Fonte:               fonte,
+		DataGeracao:         time.Now().Format(time.RFC3339),
+		Adicionados:         []VeiculoDelta{},
+		Removidos:           []VeiculoDelta{},
+		Alterados:           []VeiculoAlterado{},
+	}
+
+	antes := map[string]*VeiculoXML{}
+	if anterior != nil {
+		for i := range anterior.Stock {
+			if _, repetido := antes[anterior.Stock[i].Identificador]; !repetido {
+				antes[anterior.Stock[i].Identificador] = &anterior.Stock[i]
+			}
+		}
+	}
+	// Sem os valores anteriores destes veículos, não há com que comparar
+	rejeitadoAntes := map[string]bool{}
+	for _, id := range rejeitadosAnterior.IDs {
+		rejeitadoAntes[id] = true
+	}
+	// Um veículo rejeitado continua no stock da fonte, só não entrou no XML
+	agora := map[string]bool{}
+	for _, id := range rejeitados.IDs {
+		agora[id] = true
+	}
+
+	comparados := map[string]bool{}
+	for i := range atual.Stock {
+		v := &atual.Stock[i]
+		agora[v.Identificador] = true
+		if comparados[v.Identificador] {
+			continue
+		}
+		comparados[v.Identificador] = true
+		a, existia := antes[v.Identificador]
+		if !existia {
+			if !rejeitadoAntes[v.Identificador] {
+				d.Adicionados = append(d.Adicionados, veiculoDelta(v))
+			}
+			continue
+		}
+
+		alterado := VeiculoAlterado{IDInterno: v.Identificador, Designacao: v.Identificacao.Designacao}
+		for _, campo := range camposDelta {
+			alteracao, mudou := compararCampo(campo, a, v)
+			if !mudou {
+				continue
+			}
+			alterado.Alteracoes = append(alterado.Alteracoes, alteracao)
+			switch campo {
+			case "Identificacao/Preco":
+				if alteracao.Sentido == SentidoSubiu {
+					d.Resumo.PrecoSubiu++
+				} else {
+					d.Resumo.PrecoDesceu++
+				}
+			case "HistoricoUso/Kilometragem":
+				d.Resumo.KmAlterados++
+			}
+		}
+		if len(alterado.Alteracoes) > 0 {
+			d.Alterados = append(d.Alterados, alterado)
+		}
+	}
+
+	if anterior != nil && rejeitados.SemID == 0 {
+		for i := range anterior.Stock {
+			if v := &anterior.Stock[i]; !agora[v.Identificador] && antes[v.Identificador] == v {
+				d.Removidos = append(d.Removidos, veiculoDelta(v))
+			}
+		}
+	}
+
+	d.Resumo.Adicionados = len(d.Adicionados)
+	d.Resumo.Removidos = len(d.Removidos)
+	d.Resumo.Alterados = len(d.Alterados)
+	return d
+}
+
+func veiculoDelta(v *VeiculoXML) VeiculoDelta {
+	return VeiculoDelta{IDInterno: v.Identificador, Designacao: v.Identificacao.Designacao, Preco: v.Identificacao.Preco}
+}
+
+func compararCampo(campo string, anterior *VeiculoXML, atual *VeiculoXML) (AlteracaoCampo, bool) {
+	ler := valoresVeiculo[campo]
+	antes, depois := ler(anterior), ler(atual)
+	alteracao := AlteracaoCampo{Campo: campo}
+
+	if a, numerico := antes.(float64); numerico {
+		b := depois.(float64)
+		if a == b {
+			return alteracao, false
+		}
+		alteracao.Anterior, alteracao.Novo = formatarNumero(a), formatarNumero(b)
+		alteracao.Sentido = SentidoSubiu
+		if b < a {
+			alteracao.Sentido = SentidoDesceu
+		}
+		return alteracao, true
+	}
+
+	a, b := strings.TrimSpace(fmt.Sprint(antes)), strings.TrimSpace(fmt.Sprint(depois))
+	if a == b {
+		return alteracao, false
+	}
+	alteracao.Anterior, alteracao.Novo = a, b
+	return alteracao, true
+}
+
+// GerarDelta compara o documento acabado de guardar com o anterior da mesma fonte, valida o XML do
+// delta contra o seu XSD e guarda-o em relatorios_delta
+func GerarDelta(db *sql.DB, esquema *EsquemaXSD, documentoID int64, reqID string, fonte string, atual *ListaVeiculos, rejeitados Rejeitados) (*RelatorioDelta, error) {
+	var anteriorID int64
+	var anteriorXML string
+	var rejeitadosAnterior Rejeitados
+	query := `SELECT id, xml_documento, ids_rejeitados, rejeitadas_sem_id FROM veiculos_xml
+		WHERE fonte = $1 AND id < $2 ORDER BY id DESC LIMIT 1`
+	err := db.QueryRow(query, fonte, documentoID).Scan(&anteriorID, &anteriorXML, pq.Array(&rejeitadosAnterior.IDs), &rejeitadosAnterior.SemID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println("Erro ao ler documento anterior:", err)
+		return nil, err
+	}
+
+	var anterior *ListaVeiculos
+	if err == nil {
+		anterior = &ListaVeiculos{}
+		if err := xml.Unmarshal([]byte(anteriorXML), anterior); err != nil {
+			return nil, fmt.Errorf("documento anterior %d: %v", anteriorID, err)
+		}
+	}
+
+	delta := CalcularDelta(documentoID, anteriorID, fonte, anterior, atual, rejeitados, rejeitadosAnterior)
+	xmlDelta, err := delta.XML()
+	if err != nil {
+		return nil, err
+	}
+	if err := validarDelta(esquema, xmlDelta); err != nil {
+		return nil, err
+	}
+
+	dados, _ := json.Marshal(delta)
+	var anteriorNulo sql.NullInt64
+	if anteriorID > 0 {
+		anteriorNulo = sql.NullInt64{Int64: anteriorID, Valid: true}
+	}
+	_, err = db.Exec(`INSERT INTO relatorios_delta (documento_id, documento_anterior_id, fonte, request_id, adicionados, removidos,
+			alterados, delta, xml_delta, data_criacao)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		documentoID, anteriorNulo, fonte, reqID, delta.Resumo.Adicionados, delta.Resumo.Removidos, delta.Resumo.Alterados,
+		string(dados), xmlDelta, time.Now())
+	if err != nil {
+		log.Println("Erro ao guardar delta:", err)
+		return nil, err
+	}
+	return delta, nil
+}
+
+// XML devolve o delta como documento XML, com o cabeçalho
+func (d *RelatorioDelta) XML() (string, error) {
+	xmlBytes, err := xml.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return xml.Header + string(xmlBytes), nil
+}
+
+func validarDelta(esquema *EsquemaXSD, xmlDelta string) error {
+	doc, err := libxml2.ParseString(xmlDelta)
+	if err != nil {
+		return err
+	}
+	defer doc.Free()
+
+	erros, err := esquema.Validar(doc)
+	if err != nil {
+		return err
+	}
+	if len(erros) > 0 {
+		return fmt.Errorf("delta rejeitado pelo XSD: %s (linha %d)", erros[0].Mensagem, erros[0].LinhaXML)
+	}
+	return nil
+}
+
+// GetRelatorioDelta lê o delta guardado de um documento, em JSON e em XML (nil se não existir)
+func GetRelatorioDelta(db *sql.DB, documentoID int64) (*RelatorioDelta, string, error) {
+	var dados []byte
+	var xmlDelta string
+	err := db.QueryRow(`SELECT delta, xml_delta FROM relatorios_delta WHERE documento_id = $1`, documentoID).Scan(&dados, &xmlDelta)
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	if err != nil {
+		log.Println("Erro ao ler delta:", err)
+		return nil, "", err
+	}
+	delta := &RelatorioDelta{}
+	if err := json.Unmarshal(dados, delta); err != nil {
+		return nil, "", err
+	}
+	return delta, xmlDelta, nil
+}
+
+// querXML indica se o cliente pediu XML (?formato=xml ou Accept: application/xml)
+func querXML(r *http.Request) bool {
+	if f := r.URL.Query().Get("formato"); f != "" {
+		return strings.EqualFold(f, "xml")
+	}
+	aceita := r.Header.Get("Accept")
+	return strings.Contains(aceita, "/xml") && !strings.Contains(aceita, "application/json")
+}
+
+// registarRotasDelta expõe o delta de cada documento em JSON (por defeito) ou XML
+func registarRotasDelta(db *sql.DB) {
+	http.HandleFunc("GET /documentos/{id}/delta", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "id inválido", 400)
+			return
+		}
+		delta, xmlDelta, err := GetRelatorioDelta(db, id)
+		if err != nil {
+			http.Error(w, "Erro ao ler delta", 500)
+			return
+		}
+		if delta == nil {
+			http.Error(w, "Delta não encontrado", 404)
+			return
+		}
+
+		if querXML(r) {
+			w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+			w.Write([]byte(xmlDelta))
+			return
+		}
+		responderJSON(w, http.StatusOK, delta)
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import "testing"
+
+func stockDelta(ids ...string) *ListaVeiculos {
+	l := &ListaVeiculos{}
+	for _, id := range ids {
+		l.Stock = append(l.Stock, VeiculoXML{Identificador: id})
+	}
+	return l
+}
+
+func idsDelta(veiculos []VeiculoDelta) []string {
+	ids := []string{}
+	for _, v := range veiculos {
+		ids = append(ids, v.IDInterno)
+	}
+	return ids
+}
+
+func TestCalcularDeltaUploadParcial(t *testing.T) {
+	anterior := stockDelta("A", "B", "C")
+	atual := stockDelta("A")
+
+	casos := []struct {
+		nome       string
+		rejeitados Rejeitados
+		removidos  []string
+	}{
+		{"upload completo", Rejeitados{}, []string{"B", "C"}},
+		{"rejeitado com IDInterno", Rejeitados{IDs: []string{"B"}}, []string{"C"}},
+		{"rejeitado sem IDInterno", Rejeitados{IDs: []string{"B"}, SemID: 1}, []string{}},
+	}
+	for _, c := range casos {
+		d := CalcularDelta(2, 1, "teste", anterior, atual, c.rejeitados, Rejeitados{})
+		removidos := idsDelta(d.Removidos)
+		if len(removidos) != len(c.removidos) || d.Resumo.Removidos != len(c.removidos) {
+			t.Errorf("%s: removidos %v (resumo %d), esperados %v", c.nome, removidos, d.Resumo.Removidos, c.removidos)
+			continue
+		}
+		for i := range removidos {
+			if removidos[i] != c.removidos[i] {
+				t.Errorf("%s: removidos %v, esperados %v", c.nome, removidos, c.removidos)
+				break
+			}
+		}
+		if d.Resumo.Adicionados != 0 {
+			t.Errorf("%s: %d adicionados, esperados 0", c.nome, d.Resumo.Adicionados)
+		}
+	}
+}
+
+func TestCalcularDeltaRejeitadoNoAnterior(t *testing.T) {
+	anterior := stockDelta("A", "B")
+	atual := stockDelta("A", "B", "C", "D")
+
+	// C foi rejeitado no upload anterior: já estava no stock da fonte, só D é novo
+	d := CalcularDelta(2, 1, "teste", anterior, atual, Rejeitados{}, Rejeitados{IDs: []string{"C"}})
+	if adicionados := idsDelta(d.Adicionados); len(adicionados) != 1 || adicionados[0] != "D" || d.Resumo.Adicionados != 1 {
+		t.Errorf("adicionados %v (resumo %d), esperado [D]", adicionados, d.Resumo.Adicionados)
+	}
+	if d.Resumo.Removidos != 0 || d.Resumo.Alterados != 0 {
+		t.Errorf("resumo %+v, esperados 0 removidos e 0 alterados", d.Resumo)
+	}
+}
+
+func TestCalcularDeltaIDRepetido(t *testing.T) {
+	anterior := stockDelta("A", "B", "B")
+	atual := stockDelta("A", "C", "C")
+	atual.Stock[2].Identificacao.Preco = 5000
+
+	d := CalcularDelta(2, 1, "teste", anterior, atual, Rejeitados{}, Rejeitados{})
+	if adicionados := idsDelta(d.Adicionados); len(adicionados) != 1 || adicionados[0] != "C" || d.Adicionados[0].Preco != 0 {
+		t.Errorf("adicionados %+v, esperado só a primeira ocorrência de C", d.Adicionados)
+	}
+	if removidos := idsDelta(d.Removidos); len(removidos) != 1 || removidos[0] != "B" {
+		t.Errorf("removidos %v, esperado [B]", removidos)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Paginação de GET /documentos
+const (
+	documentosPorPagina    = 50
+	maxDocumentosPorPagina = 200
+)
+
+// DocumentoXML são os metadados de um documento guardado em veiculos_xml
+type DocumentoXML struct {
+	Id            int64     `json:"id"`
+	RequestId     string    `json:"requestId,omitempty"`
+	MapperVersion string    `json:"mapper,omitempty"`
+	VersaoXSD     string    `json:"versaoXsd"`
+	Fonte         string    `json:"fonte"`
+	DataCriacao   time.Time `json:"dataCriacao"`
+	TotalVeiculos int       `json:"totalVeiculos"`
+	TamanhoBytes  int64     `json:"tamanhoBytes"`
+	ETag          string    `json:"etag"`
+}
+
+// FiltroDocumentos são os filtros de GET /documentos; os campos vazios não filtram
+type FiltroDocumentos struct {
+	Desde     *time.Time
+	Ate       *time.Time // Exclusivo
+	Mapper    string
+	RequestId string
+	Fonte     string
+	Pagina    int
+	PorPagina int
+}
+
+// PaginaDocumentos é a resposta de GET /documentos
+type PaginaDocumentos struct {
+	Documentos []DocumentoXML `json:"documentos"`
+	Pagina     int            `json:"pagina"`
+	PorPagina  int            `json:"porPagina"`
+	Total      int            `json:"total"`
+}
+
+const colunasDocumento = `d.id, d.request_id, d.mapper_version, d.versao_xsd, d.fonte, d.data_criacao,
+	(SELECT COUNT(*) FROM veiculos v WHERE v.documento_id = d.id), octet_length(d.xml_documento::text), d.xml_sha256`
+
+func lerDocumento(scan func(dest ...any) error) (*DocumentoXML, error) {
+	doc := &DocumentoXML{}
+	var reqID, mapper, hash sql.NullString
+	err := scan(&doc.Id, &reqID, &mapper, &doc.VersaoXSD, &doc.Fonte, &doc.DataCriacao, &doc.TotalVeiculos, &doc.TamanhoBytes, &hash)
+	if err != nil {
+		return nil, err
+	}
+	doc.RequestId = reqID.String
+	doc.MapperVersion = mapper.String
+	doc.ETag = etagDocumento(doc.Id, hash.String)
+	return doc, nil
+}
+
+// etagDocumento usa o hash do XML; o id entra para que dois documentos iguais não partilhem a ETag
+func etagDocumento(id int64, hash string) string {
+	if len(hash) > 32 {
+		hash = hash[:32]
+	}
+	return fmt.Sprintf(`"%d-%s"`, id, hash)
+}
+
+// ListDocumentos devolve uma página de documentos, do mais recente para o mais antigo
+func ListDocumentos(db *sql.DB, f FiltroDocumentos) (*PaginaDocumentos, error) {
+	var condicoes []string
+	var args []any
+	juntar := func(condicao string, valor any) {
+		args = append(args, valor)
+		condicoes = append(condicoes, fmt.Sprintf(condicao, len(args)))
+	}
+	if f.Desde != nil {
+		juntar("d.data_criacao >= $%d", *f.Desde)
+	}
+	if f.Ate != nil {
+		juntar("d.data_criacao < $%d", *f.Ate)
+	}
+	if f.Mapper != "" {
+		juntar("d.mapper_version = $%d", f.Mapper)
+	}
+	if f.RequestId != "" {
+		juntar("d.request_id = $%d", f.RequestId)
+	}
+	if f.Fonte != "" {
+		juntar("d.fonte = $%d", f.Fonte)
+	}
+	where := ""
+	if len(condicoes) > 0 {
+		where = " WHERE " + strings.Join(condicoes, " AND ")
+	}
+
+	pagina := &PaginaDocumentos{Documentos: []DocumentoXML{}, Pagina: f.Pagina, PorPagina: f.PorPagina}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM veiculos_xml d`+where, args...).Scan(&pagina.Total); err != nil {
+		log.Println("Erro ao contar documentos:", err)
+		return nil, err
+	}
+
+	args = append(args, f.PorPagina, int64(f.Pagina-1)*int64(f.PorPagina))
+	query := fmt.Sprintf(`SELECT %s FROM veiculos_xml d%s ORDER BY d.data_criacao DESC, d.id DESC LIMIT $%d OFFSET $%d`,
+		colunasDocumento, where, len(args)-1, len(args))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Println("Erro ao listar documentos:", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		doc, err := lerDocumento(rows.Scan)
+		if err != nil {
+			log.Println("Erro ao ler documento:", err)
+			return nil, err
+		}
+		pagina.Documentos = append(pagina.Documentos, *doc)
+	}
+	return pagina, rows.Err()
+}
+
+// GetDocumento devolve os metadados do documento, ou nil se não existir
+func GetDocumento(db *sql.DB, id int64) (*DocumentoXML, error) {
+	doc, err := lerDocumento(db.QueryRow(`SELECT `+colunasDocumento+` FROM veiculos_xml d WHERE d.id = $1`, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.Println("Erro ao ler documento:", err)
+		return nil, err
+	}
+	return doc, nil
+}
+
+// GetXMLDocumento devolve o XML guardado ("" se o documento não existir)
+func GetXMLDocumento(db *sql.DB, id int64) (string, error) {
+	var xmlDoc string
+	err := db.QueryRow(`SELECT xml_documento FROM veiculos_xml WHERE id = $1`, id).Scan(&xmlDoc)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		log.Println("Erro ao ler XML do documento:", err)
+		return "", err
+	}
+	return xmlDoc, nil
+}
+
+// lerFiltroDocumentos valida os parâmetros de GET /documentos
+func lerFiltroDocumentos(r *http.Request) (FiltroDocumentos, error) {
+	q := r.URL.Query()
+	f := FiltroDocumentos{
+		Mapper:    q.Get("mapper"),
+		RequestId: q.Get("requestId"),
+		Fonte:     q.Get("fonte"),
+		Pagina:    1,
+		PorPagina: documentosPorPagina,
+	}
+
+	var err error
+	if f.Desde, err = lerData(q.Get("desde"), false); err != nil {
+		return f, err
+	}
+	if f.Ate, err = lerData(q.Get("ate"), true); err != nil {
+		return f, err
+	}
+	if v := q.Get("pagina"); v != "" {
+		if f.Pagina, err = strconv.Atoi(v); err != nil || f.Pagina < 1 {
+			return f, fmt.Errorf("pagina inválida: %s", v)
+		}
+	}
+	if v := q.Get("porPagina"); v != "" {
+		if f.PorPagina, err = strconv.Atoi(v); err != nil || f.PorPagina < 1 || f.PorPagina > maxDocumentosPorPagina {
+			return f, fmt.Errorf("porPagina inválido: %s (1 a %d)", v, maxDocumentosPorPagina)
+		}
+	}
+	// O OFFSET, (pagina-1)*porPagina, tem de caber num bigint
+	if int64(f.Pagina-1) > math.MaxInt64/int64(f.PorPagina) {
+		return f, fmt.Errorf("pagina inválida: %d (demasiado grande)", f.Pagina)
+	}
+	return f, nil
+}
+
+// lerData aceita RFC3339 ou só a data (AAAA-MM-DD). Só com a data, o limite superior inclui o dia todo.
+func lerData(valor string, fim bool) (*time.Time, error) {
+	if valor == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, valor); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", valor, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("data inválida: %s (AAAA-MM-DD ou RFC3339)", valor)
+	}
+	if fim {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// etagCorresponde trata o If-None-Match (lista de ETags ou *)
+func etagCorresponde(r *http.Request, etag string) bool {
+	for _, v := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == etag || v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// registarRotasDocumentos expõe a listagem, os metadados e o XML dos documentos guardados
+func registarRotasDocumentos(db *sql.DB) {
+	http.HandleFunc("GET /documentos", func(w http.ResponseWriter, r *http.Request) {
+		f, err := lerFiltroDocumentos(r)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		pagina, err := ListDocumentos(db, f)
+		if err != nil {
+			http.Error(w, "Erro ao listar documentos", 500)
+			return
+		}
+		responderJSON(w, http.StatusOK, pagina)
+	})
+
+	http.HandleFunc("GET /documentos/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "id inválido", 400)
+			return
+		}
+		doc, err := GetDocumento(db, id)
+		if err != nil {
+			http.Error(w, "Erro ao ler documento", 500)
+			return
+		}
+		if doc == nil {
+			http.Error(w, "Documento não encontrado", 404)
+			return
+		}
+		responderJSON(w, http.StatusOK, doc)
+	})
+
+	// Os documentos não mudam depois de guardados: o cliente revalida com If-None-Match e recebe 304
+	http.HandleFunc("GET /documentos/{id}/xml", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "id inválido", 400)
+			return
+		}
+		doc, err := GetDocumento(db, id)
+		if err != nil {
+			http.Error(w, "Erro ao ler documento", 500)
+			return
+		}
+		if doc == nil {
+			http.Error(w, "Documento não encontrado", 404)
+			return
+		}
+
+		w.Header().Set("ETag", doc.ETag)
+		w.Header().Set("Cache-Control", "private, max-age=0, must-revalidate")
+		if etagCorresponde(r, doc.ETag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		xmlDoc, err := GetXMLDocumento(db, id)
+		if err != nil {
+			http.Error(w, "Erro ao ler documento", 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(xmlDoc)))
+		w.Write([]byte(xmlDoc))
+	})
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLerFiltroDocumentosPaginacao(t *testing.T) {
+	casos := []struct {
+		query     string
+		valido    bool
+		pagina    int
+		porPagina int
+	}{
+		{"", true, 1, documentosPorPagina},
+		{"pagina=3&porPagina=20", true, 3, 20},
+		{"pagina=0", false, 0, 0},
+		{"pagina=-1", false, 0, 0},
+		{"porPagina=201", false, 0, 0},
+		// (pagina-1)*porPagina passava de um int64 e o OFFSET ficava negativo
+		{"pagina=9223372036854775807&porPagina=200", false, 0, 0},
+		{"pagina=46116860184273881&porPagina=200", false, 0, 0},
+		{"pagina=46116860184273880&porPagina=200", true, 46116860184273880, 200},
+	}
+	for _, c := range casos {
+		f, err := lerFiltroDocumentos(httptest.NewRequest("GET", "/documentos?"+c.query, nil))
+		if (err == nil) != c.valido {
+			t.Errorf("%q: erro %v, esperado válido=%v", c.query, err, c.valido)
+			continue
+		}
+		if c.valido && (f.Pagina != c.pagina || f.PorPagina != c.porPagina) {
+			t.Errorf("%q: pagina %d porPagina %d, esperado %d e %d", c.query, f.Pagina, f.PorPagina, c.pagina, c.porPagina)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RegistoEntrega é uma entrega da webhook_outbox, com o histórico de tentativas
+type RegistoEntrega struct {
+	Id               int64              `json:"id"`
+	DeliveryId       string             `json:"deliveryId"`
+	SubscricaoId     *int64             `json:"subscricaoId,omitempty"`
+	Evento           string             `json:"evento"`
+	RequestId        string             `json:"requestId"`
+	URL              string             `json:"url"`
+	Estado           string             `json:"estado"`
+	Tentativas       int                `json:"tentativas"`
+	UltimoErro       string             `json:"ultimoErro,omitempty"`
+	ProximaTentativa *time.Time         `json:"proximaTentativa,omitempty"`
+	DataCriacao      time.Time          `json:"dataCriacao"`
+	DataEntrega      *time.Time         `json:"dataEntrega,omitempty"`
+	Payload          json.RawMessage    `json:"payload,omitempty"`
+	Historico        []TentativaEntrega `json:"historico"`
+}
+
+// TentativaEntrega guarda o que foi enviado numa tentativa e o que o destinatário respondeu
+type TentativaEntrega struct {
+	Id             int64     `json:"id"`
+	EntregaId      int64     `json:"entregaId"`
+	Tentativa      int       `json:"tentativa"`
+	Manual         bool      `json:"manual"` // Reenvio pedido em /admin/entregas/{id}/reenviar
+	Corpo          string    `json:"corpo,omitempty"`
+	CodigoResposta *int      `json:"codigoResposta,omitempty"`
+	Resposta       string    `json:"resposta,omitempty"`
+	LatenciaMs     int64     `json:"latenciaMs"`
+	Erro           string    `json:"erro,omitempty"`
+	DataTentativa  time.Time `json:"dataTentativa"`
+}
+
+// RegistarTentativa acrescenta uma tentativa ao histórico de webhook_tentativas
+func RegistarTentativa(db *sql.DB, t *TentativaEntrega) {
+	var codigo sql.NullInt64
+	if t.CodigoResposta != nil {
+		codigo = sql.NullInt64{Int64: int64(*t.CodigoResposta), Valid: true}
+	}
+	var erro sql.NullString
+	if t.Erro != "" {
+		erro = sql.NullString{String: t.Erro, Valid: true}
+	}
+
+	query := `INSERT INTO webhook_tentativas (entrega_id, tentativa, manual, corpo, codigo_resposta, resposta, latencia_ms, erro, data_tentativa)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+	err := db.QueryRow(query, t.EntregaId, t.Tentativa, t.Manual, t.Corpo, codigo, t.Resposta, t.LatenciaMs, erro, t.DataTentativa).Scan(&t.Id)
+	if err != nil {
+		log.Println("Erro ao registar tentativa de webhook:", err)
+	}
+}
+
+const colunasEntrega = `id, delivery_id, subscricao_id, evento, request_id, url, estado, tentativas, ultimo_erro,
+	proxima_tentativa, data_criacao, data_entrega, payload`
+
+func lerEntrega(scan func(dest ...any) error) (*RegistoEntrega, error) {
+	en := &RegistoEntrega{}
+	var subscricao sql.NullInt64
+	var ultimoErro sql.NullString
+	var proxima, entrega sql.NullTime
+	var payload string
+
+	err := scan(&en.Id, &en.DeliveryId, &subscricao, &en.Evento, &en.RequestId, &en.URL, &en.Estado, &en.Tentativas,
+		&ultimoErro, &proxima, &en.DataCriacao, &entrega, &payload)
+	if err != nil {
+		return nil, err
+	}
+	if subscricao.Valid {
+		en.SubscricaoId = &subscricao.Int64
+	}
+	en.UltimoErro = ultimoErro.String
+	// A próxima tentativa só interessa enquanto a entrega está pendente
+	if proxima.Valid && en.Estado == EntregaPendente {
+		en.ProximaTentativa = &proxima.Time
+	}
+	if entrega.Valid {
+		en.DataEntrega = &entrega.Time
+	}
+	en.Payload = json.RawMessage(payload)
+	return en, nil
+}
+
+// ListEntregas devolve as entregas de um requestId (webhookUrl do upload e subscrições), com as tentativas
+func ListEntregas(db *sql.DB, reqID string) ([]RegistoEntrega, error) {
+	rows, err := db.Query(`SELECT `+colunasEntrega+` FROM webhook_outbox WHERE request_id = $1 ORDER BY id`, reqID)
+	if err != nil {
+		log.Println("Erro ao listar entregas:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	entregas := []RegistoEntrega{}
+	for rows.Next() {
+		en, err := lerEntrega(rows.Scan)
+		if err != nil {
+			log.Println("Erro ao ler entrega:", err)
+			return nil, err
+		}
+		entregas = append(entregas, *en)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Na listagem o corpo enviado já vem no payload da entrega
+	for i := range entregas {
+		historico, err := ListTentativas(db, entregas[i].Id, false)
+		if err != nil {
+			return nil, err
+		}
+		entregas[i].Historico = historico
+	}
+	return entregas, nil
+}
+
+// GetEntrega devolve uma entrega com o histórico completo, ou nil se não existir
+func GetEntrega(db *sql.DB, id int64) (*RegistoEntrega, error) {
+	en, err := lerEntrega(db.QueryRow(`SELECT `+colunasEntrega+` FROM webhook_outbox WHERE id = $1`, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.Println("Erro ao ler entrega:", err)
+		return nil, err
+	}
+	en.Historico, err = ListTentativas(db, id, true)
+	if err != nil {
+		return nil, err
+	}
+	return en, nil
+}
+
+// ListTentativas devolve as tentativas de uma entrega por ordem; comCorpo inclui o corpo enviado em cada uma
+func ListTentativas(db *sql.DB, entregaID int64, comCorpo bool) ([]TentativaEntrega, error) {
+	query := `SELECT id, entrega_id, tentativa, manual, corpo, codigo_resposta, resposta, latencia_ms, erro, data_tentativa
+		FROM webhook_tentativas WHERE entrega_id = $1 ORDER BY id`
+	rows, err := db.Query(query, entregaID)
+	if err != nil {
+		log.Println("Erro ao listar tentativas de webhook:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	tentativas := []TentativaEntrega{}
+	for rows.Next() {
+		var t TentativaEntrega
+		var codigo sql.NullInt64
+		var resposta, erro sql.NullString
+		if err := rows.Scan(&t.Id, &t.EntregaId, &t.Tentativa, &t.Manual, &t.Corpo, &codigo, &resposta, &t.LatenciaMs, &erro, &t.DataTentativa); err != nil {
+			log.Println("Erro ao ler tentativa de webhook:", err)
+			return nil, err
+		}
+		if codigo.Valid {
+			c := int(codigo.Int64)
+			t.CodigoResposta = &c
+		}
+		if !comCorpo {
+			t.Corpo = ""
+		}
+		t.Resposta = resposta.String
+		t.Erro = erro.String
+		tentativas = append(tentativas, t)
+	}
+	return tentativas, rows.Err()
+}
+
+// ErrEntregaEntregue é devolvido pelo reenvio de uma entrega já entregue sem forcar
+var ErrEntregaEntregue = errors.New("entrega já entregue")
+
+// reenviar faz uma tentativa manual de uma entrega pelo id. A tentativa não mexe no ciclo automático:
+// se falhar, a entrega fica no estado em que estava (pendente com o seu backoff, ou em dead_letter).
+// Uma entrega já entregue só é reenviada com forcar. O delivery_id mantém-se: quem recebe pode usá-lo
+// para ignorar duplicados.
+func (e *EntregadorWebhooks) reenviar(id int64, forcar bool) (*TentativaEntrega, error) {
+	// Uma entrega pendente fica reservada durante a tentativa, como no reclamar, para que os workers
+	// não a enviem ao mesmo tempo
+	query := `UPDATE webhook_outbox SET proxima_tentativa = CASE WHEN estado = $2 THEN $3 ELSE proxima_tentativa END
+		WHERE id = $1 AND (estado <> $4 OR $5)
+		RETURNING id, delivery_id, subscricao_id, url, payload, tentativas`
+
+	en := &entregaWebhook{}
+	err := e.db.QueryRow(query, id, EntregaPendente, time.Now().Add(leaseEntrega), EntregaEntregue, forcar).Scan(&en.id, &en.deliveryID, &en.subscricaoID, &en.url, &en.payload, &en.tentativas)
+	if err == sql.ErrNoRows {
+		var existe bool
+		if err := e.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM webhook_outbox WHERE id = $1)`, id).Scan(&existe); err != nil {
+			log.Println("Erro ao reclamar entrega para reenvio:", err)
+			return nil, err
+		}
+		if existe {
+			return nil, ErrEntregaEntregue
+		}
+		return nil, nil
+	}
+	if err != nil {
+		log.Println("Erro ao reclamar entrega para reenvio:", err)
+		return nil, err
+	}
+	log.Printf("Reenvio manual da entrega %d para %s\n", en.id, en.url)
+	return e.entregar(en, true), nil
+}
+
+// protegerAdmin só deixa passar pedidos com "Authorization: Bearer <ADMIN_TOKEN>"
+func protegerAdmin(token string, h http.HandlerFunc) http.HandlerFunc {
+	esperado := []byte("Bearer " + token)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), esperado) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "Não autorizado", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// registarRotasAdmin adiciona a consulta do histórico de webhooks e o reenvio manual, protegidos por
+// token: os payloads e o reenvio de entregas assinadas não podem ficar abertos a quem chega à porta 8080.
+// Sem token as rotas não são registadas.
+func (e *EntregadorWebhooks) registarRotasAdmin(token string) {
+	if token == "" {
+		log.Println("! ADMIN_TOKEN não definido: rotas /admin/entregas desativadas")
+		return
+	}
+
+	http.HandleFunc("GET /admin/entregas", protegerAdmin(token, func(w http.ResponseWriter, r *http.Request) {
+		reqID := r.URL.Query().Get("requestId")
+		if reqID == "" {
+			http.Error(w, "requestId é obrigatório", 400)
+			return
+		}
+		entregas, err := ListEntregas(e.db, reqID)
+		if err != nil {
+			http.Error(w, "Erro ao listar entregas", 500)
+			return
+		}
+		responderJSON(w, http.StatusOK, entregas)
+	}))
+
+	http.HandleFunc("GET /admin/entregas/{id}", protegerAdmin(token, func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "id inválido", 400)
+			return
+		}
+		en, err := GetEntrega(e.db, id)
+		if err != nil {
+			http.Error(w, "Erro ao ler entrega", 500)
+			return
+		}
+		if en == nil {
+			http.Error(w, "Entrega não encontrada", 404)
+			return
+		}
+		responderJSON(w, http.StatusOK, en)
+	}))
+
+	http.HandleFunc("POST /admin/entregas/{id}/reenviar", protegerAdmin(token, func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "id inválido", 400)
+			return
+		}
+		t, err := e.reenviar(id, r.URL.Query().Get("forcar") == "true")
+		if err == ErrEntregaEntregue {
+			http.Error(w, "Entrega já entregue (forcar=true para reenviar)", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Erro ao reenviar entrega", 500)
+			return
+		}
+		if t == nil {
+			http.Error(w, "Entrega não encontrada", 404)
+			return
+		}
+		// 200 mesmo que o destinatário falhe: o resultado da tentativa vai no corpo
+		// e a entrega continua na outbox no estado em que estava
+		responderJSON(w, http.StatusOK, t)
+	}))
+}
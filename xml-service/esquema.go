@@ -0,0 +1,308 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/lestrrat-go/libxml2/types"
+	"github.com/lestrrat-go/libxml2/xsd"
+)
+
+// esperaRecarga agrupa as várias escritas que um editor faz ao gravar o ficheiro
+const esperaRecarga = 300 * time.Millisecond
+
+// ErrVersaoDesconhecida indica um documento cujo Versao não tem XSD registado
+var ErrVersaoDesconhecida = errors.New("versão de esquema desconhecida")
+
+// EsquemaXSD guarda um XSD compilado uma só vez e partilhado por todos os workers, e o
+// Schematron opcional com o mesmo nome (1.0.xsd -> 1.0.sch) para as regras entre campos.
+// A validação só lê o schema (cada chamada cria o seu contexto no libxml2), por isso basta
+// um RWMutex: as validações correm em paralelo e a troca espera que as que estão a correr acabem.
+type EsquemaXSD struct {
+	caminho    string
+	mu         sync.RWMutex
+	schema     *xsd.Schema
+	schematron *Schematron // nil se não houver .sch
+}
+
+// CarregarEsquema compila o XSD e, se existir ao lado, o Schematron
+func CarregarEsquema(caminho string) (*EsquemaXSD, error) {
+	schema, err := xsd.ParseFromFile(caminho)
+	if err != nil {
+		return nil, err
+	}
+	e := &EsquemaXSD{caminho: caminho, schema: schema}
+
+	if _, err := os.Stat(e.caminhoSchematron()); err == nil {
+		e.schematron, err = CompilarSchematron(e.caminhoSchematron())
+		if err != nil {
+			schema.Free()
+			return nil, err
+		}
+		log.Printf("Schematron ativo: %s\n", filepath.Base(e.caminhoSchematron()))
+	}
+	return e, nil
+}
+
+func (e *EsquemaXSD) caminhoSchematron() string {
+	return strings.TrimSuffix(e.caminho, filepath.Ext(e.caminho)) + ".sch"
+}
+
+// Validar valida o documento contra o schema atual e devolve os erros encontrados (vazio se for válido)
+func (e *EsquemaXSD) Validar(doc types.Document) ([]ErroDocumento, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return validarDocumentoXSD(e.schema, doc)
+}
+
+// Recarregar volta a compilar o ficheiro e troca o schema. Se a compilação falhar,
+// o schema anterior continua em uso.
+func (e *EsquemaXSD) Recarregar() error {
+	novo, err := xsd.ParseFromFile(e.caminho)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	antigo := e.schema
+	e.schema = novo
+	e.mu.Unlock()
+
+	antigo.Free()
+	return nil
+}
+
+// ValidarSchematron corre o Schematron, se existir; aplicado é false quando não há .sch
+func (e *EsquemaXSD) ValidarSchematron(doc types.Document) (erros []ErroDocumento, aplicado bool, err error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.schematron == nil {
+		return nil, false, nil
+	}
+	erros, err = e.schematron.Validar(doc)
+	return erros, true, err
+}
+
+// RecarregarSchematron volta a compilar o .sch; se falhar, o anterior continua em uso
+func (e *EsquemaXSD) RecarregarSchematron() error {
+	novo, err := CompilarSchematron(e.caminhoSchematron())
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	antigo := e.schematron
+	e.schematron = novo
+	e.mu.Unlock()
+
+	if antigo != nil {
+		antigo.Free()
+	}
+	return nil
+}
+
+// RegistoEsquemas guarda um XSD por versão do formato de saída (atributo Versao de RelatorioVeiculos).
+// Cada versão é um ficheiro <versao>.xsd na pasta de esquemas (ex: schemas/1.0.xsd, schemas/1.1.xsd).
+type RegistoEsquemas struct {
+	dir      string
+	defeito  string
+	mu       sync.RWMutex
+	esquemas map[string]*EsquemaXSD
+}
+
+// CarregarEsquemas compila todos os XSD da pasta; um erro aqui impede o serviço de arrancar.
+// defeito é a versão usada nos uploads que não pedem nenhuma.
+func CarregarEsquemas(dir string, defeito string) (*RegistoEsquemas, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	ficheiros, err := os.ReadDir(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	reg := &RegistoEsquemas{dir: abs, defeito: defeito, esquemas: map[string]*EsquemaXSD{}}
+	for _, f := range ficheiros {
+		versao, ok := versaoFicheiro(f.Name(), ".xsd")
+		if f.IsDir() || !ok {
+			continue
+		}
+		e, err := CarregarEsquema(filepath.Join(abs, f.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name(), err)
+		}
+		reg.esquemas[versao] = e
+	}
+
+	if _, ok := reg.esquemas[defeito]; !ok {
+		return nil, fmt.Errorf("não existe %s.xsd em %s (versão por defeito)", defeito, dir)
+	}
+	log.Printf("Esquemas XSD: %s (por defeito %s)\n", strings.Join(reg.Versoes(), ", "), defeito)
+	return reg, nil
+}
+
+// versaoFicheiro tira a versão do nome do ficheiro: "1.1.xsd" -> "1.1"
+func versaoFicheiro(nome string, ext string) (string, bool) {
+	if !strings.EqualFold(filepath.Ext(nome), ext) {
+		return "", false
+	}
+	versao := strings.TrimSuffix(nome, filepath.Ext(nome))
+	return versao, versao != ""
+}
+
+// Obter devolve o XSD da versão pedida
+func (r *RegistoEsquemas) Obter(versao string) (*EsquemaXSD, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.esquemas[versao]
+	return e, ok
+}
+
+// Defeito devolve a versão usada quando o upload não escolhe nenhuma
+func (r *RegistoEsquemas) Defeito() string {
+	return r.defeito
+}
+
+// Versoes devolve as versões registadas, por ordem
+func (r *RegistoEsquemas) Versoes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versoes := make([]string, 0, len(r.esquemas))
+	for v := range r.esquemas {
+		versoes = append(versoes, v)
+	}
+	sort.Strings(versoes)
+	return versoes
+}
+
+// Validar escolhe o XSD pelo atributo Versao do documento e devolve a versão usada
+func (r *RegistoEsquemas) Validar(doc types.Document) (string, []ErroDocumento, error) {
+	versao, err := versaoDocumento(doc)
+	if err != nil {
+		return "", nil, err
+	}
+	e, ok := r.Obter(versao)
+	if !ok {
+		return versao, nil, fmt.Errorf("%w: %q", ErrVersaoDesconhecida, versao)
+	}
+	erros, err := e.Validar(doc)
+	return versao, erros, err
+}
+
+// ValidarSchematron corre o Schematron da versão do documento, se essa versão tiver um
+func (r *RegistoEsquemas) ValidarSchematron(doc types.Document) ([]ErroDocumento, bool, error) {
+	versao, err := versaoDocumento(doc)
+	if err != nil {
+		return nil, false, err
+	}
+	e, ok := r.Obter(versao)
+	if !ok {
+		return nil, false, fmt.Errorf("%w: %q", ErrVersaoDesconhecida, versao)
+	}
+	return e.ValidarSchematron(doc)
+}
+
+// versaoDocumento lê RelatorioVeiculos/@Versao; sem o atributo o documento é da versão 1.0
+func versaoDocumento(doc types.Document) (string, error) {
+	raiz, err := doc.DocumentElement()
+	if err != nil {
+		return "", err
+	}
+	el, ok := raiz.(types.Element)
+	if !ok {
+		return "", errors.New("documento sem elemento raiz")
+	}
+	attr, err := el.GetAttribute("Versao")
+	if err != nil || attr.Value() == "" {
+		return "1.0", nil
+	}
+	return attr.Value(), nil
+}
+
+// Observar recompila um XSD ou Schematron sempre que o ficheiro muda, e regista as versões novas que
+// aparecem na pasta. Observa a pasta e não cada ficheiro, porque muitos editores (e os
+// volumes do Docker) gravam um ficheiro novo e fazem rename.
+func (r *RegistoEsquemas) Observar() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(r.dir); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		recargas := map[string]*time.Timer{}
+		for {
+			select {
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !ev.Has(fsnotify.Write | fsnotify.Create) {
+					continue
+				}
+				caminho := ev.Name
+				nome := filepath.Base(caminho)
+				if t := recargas[nome]; t != nil {
+					t.Stop()
+				}
+				if versao, ok := versaoFicheiro(nome, ".xsd"); ok {
+					recargas[nome] = time.AfterFunc(esperaRecarga, func() { r.recarregar(versao, caminho) })
+				} else if versao, ok := versaoFicheiro(nome, ".sch"); ok {
+					recargas[nome] = time.AfterFunc(esperaRecarga, func() { r.recarregarSchematron(versao) })
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Println("Erro ao observar esquemas XSD:", err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *RegistoEsquemas) recarregar(versao string, caminho string) {
+	if e, ok := r.Obter(versao); ok {
+		if err := e.Recarregar(); err != nil {
+			log.Printf("! XSD %s alterado mas inválido, mantém-se o anterior: %v\n", versao, err)
+			return
+		}
+		log.Printf("XSD %s recarregado\n", versao)
+		return
+	}
+
+	e, err := CarregarEsquema(caminho)
+	if err != nil {
+		log.Printf("! XSD %s novo mas inválido, não foi registado: %v\n", versao, err)
+		return
+	}
+	r.mu.Lock()
+	r.esquemas[versao] = e
+	r.mu.Unlock()
+	log.Printf("XSD %s registado\n", versao)
+}
+
+func (r *RegistoEsquemas) recarregarSchematron(versao string) {
+	e, ok := r.Obter(versao)
+	if !ok {
+		log.Printf("! Schematron %s.sch ignorado: não existe %s.xsd\n", versao, versao)
+		return
+	}
+	if err := e.RecarregarSchematron(); err != nil {
+		log.Printf("! Schematron %s alterado mas inválido, mantém-se o anterior: %v\n", versao, err)
+		return
+	}
+	log.Printf("Schematron %s recarregado\n", versao)
+}
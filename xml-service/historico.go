@@ -0,0 +1,139 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// chaveHistorico serializa as atualizações do histórico; sem isto, dois workers a guardar documentos
+// ao mesmo tempo comparavam-se com o mesmo resumo e perdia-se uma das alterações
+const chaveHistorico = 7203119
+
+// HistoricoVeiculo é a linha do tempo de um IDInterno ao longo dos uploads
+type HistoricoVeiculo struct {
+	IDInterno         string             `json:"idInterno"`
+	Designacao        string             `json:"designacao"`
+	PrimeiroDocumento int64              `json:"primeiroDocumento"`
+	PrimeiraVez       time.Time          `json:"primeiraVez"`
+	UltimoDocumento   int64              `json:"ultimoDocumento"`
+	UltimaVez         time.Time          `json:"ultimaVez"`
+	Observacoes       int                `json:"observacoes"`      // Número de documentos em que apareceu
+	Estado            string             `json:"estado,omitempty"` // ativo, removido ou reanunciado (ver anuncios)
+	DataEstado        *time.Time         `json:"dataEstado,omitempty"`
+	Alteracoes        []AlteracaoVeiculo `json:"alteracoes"`
+}
+
+// AlteracaoVeiculo é a primeira observação de um veículo ou uma mudança de Preco/Kilometragem
+type AlteracaoVeiculo struct {
+	DocumentoId   int64     `json:"documentoId"`
+	Data          time.Time `json:"data"`
+	Preco         *float64  `json:"preco"`
+	Kms           *float64  `json:"kms"`
+	PrecoAnterior *float64  `json:"precoAnterior,omitempty"`
+	KmsAnterior   *float64  `json:"kmsAnterior,omitempty"`
+	Primeira      bool      `json:"primeira"`
+}
+
+// registarHistorico compara os veículos do documento (já em veiculos) com o último valor conhecido
+// de cada IDInterno, guarda as alterações e atualiza o resumo. Corre na transação do SaveXML.
+func registarHistorico(tx *sql.Tx, documentoID int64) error {
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, chaveHistorico); err != nil {
+		return err
+	}
+
+	// Um IDInterno repetido no mesmo documento conta pela última ocorrência
+	_, err := tx.Exec(`
+		WITH doc AS (
+			SELECT DISTINCT ON (id_interno) id_interno, preco, kms, data_documento
+			FROM veiculos
+			WHERE documento_id = $1
+			ORDER BY id_interno, posicao DESC
+		)
+		INSERT INTO veiculos_historico (id_interno, documento_id, preco, kms, preco_anterior, kms_anterior, data_observacao)
+		SELECT d.id_interno, $1, d.preco, d.kms, r.preco, r.kms, d.data_documento
+		FROM doc d
+		LEFT JOIN veiculos_resumo r ON r.id_interno = d.id_interno
+		WHERE r.id_interno IS NULL OR r.preco IS DISTINCT FROM d.preco OR r.kms IS DISTINCT FROM d.kms`, documentoID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO veiculos_resumo (id_interno, primeiro_documento, primeira_vez, ultimo_documento, ultima_vez, observacoes, preco, kms)
+		SELECT DISTINCT ON (id_interno) id_interno, documento_id, data_documento, documento_id, data_documento, 1, preco, kms
+		FROM veiculos
+		WHERE documento_id = $1
+		ORDER BY id_interno, posicao DESC
+		ON CONFLICT (id_interno) DO UPDATE SET
+			observacoes = veiculos_resumo.observacoes + 1,
+			primeiro_documento = CASE WHEN `+resumoMaisAntigo+` THEN EXCLUDED.primeiro_documento ELSE veiculos_resumo.primeiro_documento END,
+			primeira_vez = CASE WHEN `+resumoMaisAntigo+` THEN EXCLUDED.primeira_vez ELSE veiculos_resumo.primeira_vez END,
+			ultimo_documento = CASE WHEN `+resumoMaisRecente+` THEN EXCLUDED.ultimo_documento ELSE veiculos_resumo.ultimo_documento END,
+			ultima_vez = CASE WHEN `+resumoMaisRecente+` THEN EXCLUDED.ultima_vez ELSE veiculos_resumo.ultima_vez END,
+			preco = CASE WHEN `+resumoMaisRecente+` THEN EXCLUDED.preco ELSE veiculos_resumo.preco END,
+			kms = CASE WHEN `+resumoMaisRecente+` THEN EXCLUDED.kms ELSE veiculos_resumo.kms END`, documentoID)
+	return err
+}
+
+// Um documento pode chegar ao registarHistorico depois de outro mais recente (a data_criacao é a do início da
+// transação e a chaveHistorico só é pedida no fim): o resumo só avança para o documento mais recente e só recua
+// a primeira observação para o mais antigo. O documento_id desempata documentos com a mesma data.
+const (
+	resumoMaisRecente = `(EXCLUDED.ultima_vez, EXCLUDED.ultimo_documento) >= (veiculos_resumo.ultima_vez, veiculos_resumo.ultimo_documento)`
+	resumoMaisAntigo  = `(EXCLUDED.primeira_vez, EXCLUDED.primeiro_documento) < (veiculos_resumo.primeira_vez, veiculos_resumo.primeiro_documento)`
+)
+
+// GetHistoricoVeiculo devolve a linha do tempo do IDInterno, ou nil se nunca foi visto
+func GetHistoricoVeiculo(db *sql.DB, idInterno string) (*HistoricoVeiculo, error) {
+	h := &HistoricoVeiculo{IDInterno: idInterno}
+	var designacao sql.NullString
+
+	query := `SELECT r.primeiro_documento, r.primeira_vez, r.ultimo_documento, r.ultima_vez, r.observacoes,
+			(SELECT designacao FROM veiculos v WHERE v.id_interno = r.id_interno AND v.documento_id = r.ultimo_documento LIMIT 1)
+		FROM veiculos_resumo r WHERE r.id_interno = $1`
+	err := db.QueryRow(query, idInterno).Scan(&h.PrimeiroDocumento, &h.PrimeiraVez, &h.UltimoDocumento, &h.UltimaVez, &h.Observacoes, &designacao)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.Println("Erro ao ler histórico do veículo:", err)
+		return nil, err
+	}
+	h.Designacao = designacao.String
+	if h.Estado, h.DataEstado, err = GetEstadoAnuncio(db, idInterno); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT documento_id, data_observacao, preco, kms, preco_anterior, kms_anterior
+		FROM veiculos_historico WHERE id_interno = $1 ORDER BY data_observacao, id`, idInterno)
+	if err != nil {
+		log.Println("Erro ao ler histórico do veículo:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	h.Alteracoes = []AlteracaoVeiculo{}
+	for rows.Next() {
+		var a AlteracaoVeiculo
+		var preco, kms, precoAnterior, kmsAnterior sql.NullFloat64
+		if err := rows.Scan(&a.DocumentoId, &a.Data, &preco, &kms, &precoAnterior, &kmsAnterior); err != nil {
+			log.Println("Erro ao ler histórico do veículo:", err)
+			return nil, err
+		}
+		a.Preco = valorOpcional(preco)
+		a.Kms = valorOpcional(kms)
+		a.PrecoAnterior = valorOpcional(precoAnterior)
+		a.KmsAnterior = valorOpcional(kmsAnterior)
+		a.Primeira = len(h.Alteracoes) == 0
+		h.Alteracoes = append(h.Alteracoes, a)
+	}
+	return h, rows.Err()
+}
+
+func valorOpcional(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
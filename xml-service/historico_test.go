@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+// Um documento mais antigo que chega ao histórico depois de um mais recente conta como observação,
+// mas não faz recuar o último documento, o preço e os kms do resumo
+func TestHistoricoDocumentoForaDeOrdem(t *testing.T) {
+	db := bdTeste(t)
+
+	antigo := guardarDocumento(t, db, "historico-1", veiculoTeste{id: "X", designacao: "Fiat 500", preco: "9000", kms: "40000"})
+	recente := guardarDocumento(t, db, "historico-2", veiculoTeste{id: "X", designacao: "Fiat 500", preco: "8500", kms: "45000"})
+
+	// Volta a registar o histórico com o documento recente primeiro, como se o antigo tivesse esperado pela chaveHistorico
+	if _, err := db.Exec(`DELETE FROM veiculos_historico; DELETE FROM veiculos_resumo`); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	for _, doc := range []int64{recente, antigo} {
+		if err := registarHistorico(tx, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	var primeiro, ultimo int64
+	var observacoes int
+	var preco, kms float64
+	err = db.QueryRow(`SELECT primeiro_documento, ultimo_documento, observacoes, preco, kms FROM veiculos_resumo WHERE id_interno = 'X'`).
+		Scan(&primeiro, &ultimo, &observacoes, &preco, &kms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if primeiro != antigo || ultimo != recente || observacoes != 2 {
+		t.Errorf("resumo com documentos %d..%d e %d observações, esperados %d..%d e 2", primeiro, ultimo, observacoes, antigo, recente)
+	}
+	if preco != 8500 || kms != 45000 {
+		t.Errorf("resumo com preco/kms %v/%v, esperado 8500/45000", preco, kms)
+	}
+}
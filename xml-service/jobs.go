@@ -0,0 +1,131 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Estados de um job de ingestão, pela ordem do pipeline
+const (
+	EstadoQueued     = "queued"
+	EstadoParsing    = "parsing"
+	EstadoValidating = "validating"
+	EstadoPersisted  = "persisted"
+	EstadoFailed     = "failed"
+)
+
+// Job é o registo persistente de um pedido de /upload
+type Job struct {
+	RequestId        string              `json:"requestId"`
+	FileName         string              `json:"fileName"`
+	MapperVersion    string              `json:"mapper"`
+	CsvSha256        string              `json:"csvSha256,omitempty"`
+	Estado           string              `json:"estado"`
+	StatusFinal      string              `json:"status,omitempty"`
+	LinhasLidas      int                 `json:"linhasLidas"`
+	LinhasAceites    int                 `json:"linhasAceites"`
+	LinhasRejeitadas int                 `json:"linhasRejeitadas"`
+	DocumentoId      int64               `json:"documentoId,omitempty"`
+	DataCriacao      time.Time           `json:"dataCriacao"`
+	DataAtualizacao  time.Time           `json:"dataAtualizacao"`
+	DataConclusao    *time.Time          `json:"dataConclusao,omitempty"`
+	Validacao        *RelatorioValidacao `json:"validacao,omitempty"`
+}
+
+// UpdateJobEstado avança o job para a etapa seguinte do pipeline
+func UpdateJobEstado(db *sql.DB, reqID string, estado string) {
+	query := `UPDATE jobs SET estado = $2, data_atualizacao = $3 WHERE request_id = $1`
+	if _, err := db.Exec(query, reqID, estado, time.Now()); err != nil {
+		log.Println("Erro ao atualizar job:", err)
+	}
+}
+
+// FinishJob fecha o job com o estado final, o status enviado ao webhook, as contagens de linhas
+// e o id do documento guardado (0 se não chegou a ser guardado)
+func FinishJob(db *sql.DB, reqID string, estado string, status string, validacao *RelatorioValidacao, documentoID int64) {
+	var lidas, aceites, rejeitadas int
+	if validacao != nil {
+		lidas, aceites, rejeitadas = validacao.LinhasLidas, validacao.LinhasAceites, validacao.LinhasRejeitadas
+	}
+
+	var documento sql.NullInt64
+	if documentoID > 0 {
+		documento = sql.NullInt64{Int64: documentoID, Valid: true}
+	}
+
+	agora := time.Now()
+	query := `UPDATE jobs SET estado = $2, status_final = $3, linhas_lidas = $4, linhas_aceites = $5,
+			linhas_rejeitadas = $6, documento_id = $7, data_atualizacao = $8, data_conclusao = $8
+		WHERE request_id = $1`
+	if _, err := db.Exec(query, reqID, estado, status, lidas, aceites, rejeitadas, documento, agora); err != nil {
+		log.Println("Erro ao concluir job:", err)
+	}
+}
+
+// GetJob devolve o job e o relatório de validação guardado, ou nil se o pedido não existir
+func GetJob(db *sql.DB, reqID string) (*Job, error) {
+	j := &Job{}
+	var status, hash sql.NullString
+	var conclusao sql.NullTime
+	var documento sql.NullInt64
+
+	query := `SELECT request_id, file_name, mapper_version, csv_sha256, estado, status_final, linhas_lidas, linhas_aceites,
+			linhas_rejeitadas, documento_id, data_criacao, data_atualizacao, data_conclusao
+		FROM jobs WHERE request_id = $1`
+	err := db.QueryRow(query, reqID).Scan(&j.RequestId, &j.FileName, &j.MapperVersion, &hash, &j.Estado, &status,
+		&j.LinhasLidas, &j.LinhasAceites, &j.LinhasRejeitadas, &documento, &j.DataCriacao, &j.DataAtualizacao, &conclusao)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.Println("Erro ao ler job:", err)
+		return nil, err
+	}
+
+	j.StatusFinal = status.String
+	j.CsvSha256 = hash.String
+	j.DocumentoId = documento.Int64
+	if conclusao.Valid {
+		j.DataConclusao = &conclusao.Time
+	}
+	j.Validacao = GetRelatorioValidacao(db, reqID)
+	return j, nil
+}
+
+// FindJobRepetido procura um pedido anterior com o mesmo requestId ou com o mesmo CSV.
+// Pelo conteúdo só contam jobs que não falharam, para que um CSV rejeitado possa ser corrigido no processor.
+func FindJobRepetido(db *sql.DB, reqID string, csvSha256 string) (*Job, error) {
+	if job, err := GetJob(db, reqID); job != nil || err != nil {
+		return job, err
+	}
+
+	var original string
+	query := `SELECT request_id FROM jobs WHERE csv_sha256 = $1 AND estado <> $2 ORDER BY data_criacao DESC LIMIT 1`
+	err := db.QueryRow(query, csvSha256, EstadoFailed).Scan(&original)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.Println("Erro ao procurar upload repetido:", err)
+		return nil, err
+	}
+	return GetJob(db, original)
+}
+
+// handlerJob responde a GET /jobs/{requestId} com o estado atual do job
+func handlerJob(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, err := GetJob(db, r.PathValue("requestId"))
+		if err != nil {
+			http.Error(w, "Erro ao consultar job", 500)
+			return
+		}
+		if job == nil {
+			http.Error(w, "Job não encontrado", 404)
+			return
+		}
+		responderJSON(w, http.StatusOK, job)
+	}
+}
@@ -3,92 +3,331 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"database/sql"
-	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
-	"encoding/xml"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
 	"time"
 	"github.com/joho/godotenv"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"xml-service/pb"
 	"github.com/lestrrat-go/libxml2"
-    "github.com/lestrrat-go/libxml2/xsd"
 )
 
 
 type server struct {
 	pb.UnimplementedBIQueryServiceServer
-	db *sql.DB
+	db       *sql.DB
+	politica PoliticaVeiculos
 }
 
 
 func (s *server) GetMarcaStats(ctx context.Context, in *pb.Filtro) (*pb.MarcaStats, error) {
-	total, preco, kms := GetMarcaStatsXPath(s.db, in.GetTermo())
+	total, preco, kms := GetMarcaStats(s.db, s.politica, in.GetApenasAtivos(), in.GetTermo())
 	return &pb.MarcaStats{Total: total, MediaPreco: preco, MediaKms: kms}, nil
 }
 
 func (s *server) GetContagemSegmento(ctx context.Context, in *pb.Filtro) (*pb.Resultado, error) {
-	total := GetCountSegmentoXPath(s.db, in.GetTermo())
+	total := GetCountSegmento(s.db, s.politica, in.GetApenasAtivos(), in.GetTermo())
 	return &pb.Resultado{Valor: float32(total)}, nil
 }
 
 func (s *server) GetLocalizacaoStats(ctx context.Context, in *pb.Filtro) (*pb.LocalizacaoStats, error) {
-	total, valor := GetLocalizacaoStatsXPath(s.db, in.GetTermo())
+	total, valor := GetLocalizacaoStats(s.db, s.politica, in.GetApenasAtivos(), in.GetTermo())
 	return &pb.LocalizacaoStats{TotalCarros: total, ValorTotal: valor}, nil
 }
 
-func callWebhook(url string, reqID string, status string, fileName string) {
-	data := WebhookResponse{RequestId: reqID, Status: status, FileName: fileName}
-	jsonData, _ := json.Marshal(data)
-	_, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+func (s *server) GetEstadoJob(ctx context.Context, in *pb.Filtro) (*pb.EstadoJob, error) {
+	job, err := GetJob(s.db, in.GetTermo())
 	if err != nil {
-		fmt.Printf("! Erro Webhook: %v\n", err)
-		return
+		return nil, status.Error(codes.Internal, "erro ao consultar job")
+	}
+	if job == nil {
+		return nil, status.Error(codes.NotFound, "job não encontrado")
+	}
+
+	res := &pb.EstadoJob{
+		RequestId:        job.RequestId,
+		FileName:         job.FileName,
+		Mapper:           job.MapperVersion,
+		Estado:           job.Estado,
+		Status:           job.StatusFinal,
+		LinhasLidas:      int32(job.LinhasLidas),
+		LinhasAceites:    int32(job.LinhasAceites),
+		LinhasRejeitadas: int32(job.LinhasRejeitadas),
+		DataCriacao:      job.DataCriacao.Format(time.RFC3339),
+		DataAtualizacao:  job.DataAtualizacao.Format(time.RFC3339),
 	}
-	fmt.Printf(">\nWebhook avisado [%s]: %s\n", status, fileName)
+	if job.DataConclusao != nil {
+		res.DataConclusao = job.DataConclusao.Format(time.RFC3339)
+	}
+	if job.Validacao != nil {
+		res.Resultado = job.Validacao.Resultado
+	}
+	return res, nil
 }
 
-func validar(lista ListaVeiculos) (bool, string) {
-    if len(lista.Stock) == 0 {
-        return false, "ERRO_NEGOCIO: Lista de veículos vazia"
-    }
-    return true, "SUCCESS"
+func (s *server) GetVeiculoHistorico(ctx context.Context, in *pb.Filtro) (*pb.VeiculoHistorico, error) {
+	h, err := GetHistoricoVeiculo(s.db, in.GetTermo())
+	if err != nil {
+		return nil, status.Error(codes.Internal, "erro ao consultar histórico")
+	}
+	if h == nil {
+		return nil, status.Error(codes.NotFound, "veículo não encontrado")
+	}
+
+	res := &pb.VeiculoHistorico{
+		IdInterno:         h.IDInterno,
+		Designacao:        h.Designacao,
+		PrimeiroDocumento: h.PrimeiroDocumento,
+		PrimeiraVez:       h.PrimeiraVez.Format(time.RFC3339),
+		UltimoDocumento:   h.UltimoDocumento,
+		UltimaVez:         h.UltimaVez.Format(time.RFC3339),
+		Observacoes:       int32(h.Observacoes),
+		Estado:            h.Estado,
+	}
+	if h.DataEstado != nil {
+		res.DataEstado = h.DataEstado.Format(time.RFC3339)
+	}
+	// Valores em falta no XML vão a 0, como nas outras estatísticas
+	valor := func(v *float64) float32 {
+		if v == nil {
+			return 0
+		}
+		return float32(*v)
+	}
+	for _, a := range h.Alteracoes {
+		res.Alteracoes = append(res.Alteracoes, &pb.AlteracaoVeiculo{
+			DocumentoId:   a.DocumentoId,
+			Data:          a.Data.Format(time.RFC3339),
+			Preco:         valor(a.Preco),
+			Kms:           valor(a.Kms),
+			PrecoAnterior: valor(a.PrecoAnterior),
+			KmsAnterior:   valor(a.KmsAnterior),
+			Primeira:      a.Primeira,
+		})
+	}
+	return res, nil
 }
 
-func validarComXSD(xmlString string) (bool, string) {
-	// 1. Parse do XSD (garante que o ficheiro schema.xsd está na pasta)
-	schema, err := xsd.ParseFromFile("schema.xsd")
+func (s *server) GetDiasNoMercado(ctx context.Context, in *pb.Filtro) (*pb.DiasNoMercado, error) {
+	agrupamento := in.GetTermo()
+	if agrupamento == "" {
+		agrupamento = AgruparMarca
+	}
+	if _, ok := expressaoAgrupamento[agrupamento]; !ok {
+		return nil, status.Error(codes.InvalidArgument, "agrupamento desconhecido: use marca ou segmento")
+	}
+	grupos, err := GetDiasNoMercado(s.db, agrupamento)
 	if err != nil {
-		return false, "ERRO_SISTEMA: Falha ao carregar XSD"
+		return nil, status.Error(codes.Internal, "erro ao calcular dias no mercado")
+	}
+
+	res := &pb.DiasNoMercado{Agrupamento: agrupamento}
+	for _, g := range grupos {
+		res.Grupos = append(res.Grupos, &pb.DiasNoMercadoGrupo{
+			Grupo:              g.Grupo,
+			Anuncios:           int32(g.Anuncios),
+			Ativos:             int32(g.Ativos),
+			Removidos:          int32(g.Removidos),
+			MediaDias:          float32(g.MediaDias),
+			MediaDiasRemovidos: float32(g.MediaDiasRemovidos),
+		})
+	}
+	return res, nil
+}
+
+// responderUpload devolve ao cliente o job que ficou responsável pelo upload.
+// O estado pode ser acompanhado em /jobs/{requestId}.
+func responderUpload(w http.ResponseWriter, code int, reqID string, estado string, status string, repetido bool) {
+	w.Header().Set("Location", "/jobs/"+reqID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(RespostaUpload{RequestId: reqID, Estado: estado, Status: status, Repetido: repetido})
+}
+
+// responderJSON escreve a resposta em JSON com o código indicado
+func responderJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// envInt lê uma variável de ambiente inteira, com valor por defeito
+func envInt(nome string, defeito int) int {
+	n, err := strconv.Atoi(os.Getenv(nome))
+	if err != nil || n <= 0 {
+		return defeito
 	}
-	defer schema.Free()
+	return n
+}
 
-	// 2. Parse do XML gerado
+// validarComXSD devolve também a lista de erros individuais do libxml2, quando a validação falha,
+// cada um com a linha, o XPath do nó e o Veiculo onde ocorreu (ver ErroDocumento)
+// O XSD já vem compilado e é escolhido pelo atributo Versao do documento (ver RegistoEsquemas)
+func validarComXSD(esquemas *RegistoEsquemas, xmlString string) (bool, string, []ErroDocumento) {
+	// 1. Parse do XML gerado
 	doc, err := libxml2.ParseString(xmlString)
 	if err != nil {
-		return false, "ERRO_XML: XML mal formatado"
+		return false, "ERRO_XML: XML mal formatado", nil
 	}
 	defer doc.Free()
 
-	// 3. Validação real
-	if err := schema.Validate(doc); err != nil {
-		return false, "ERRO_XSD: " + err.Error()
+	// 2. Validação real
+	_, erros, err := esquemas.Validar(doc)
+	if err != nil {
+		return false, "ERRO_XSD: " + err.Error(), nil
+	}
+	if len(erros) > 0 {
+		return false, fmt.Sprintf("ERRO_XSD: %d erros de validação", len(erros)), erros
 	}
 
-	return true, "SUCCESS"
+	return true, "SUCCESS", nil
 }
 
+// validarComSchematron corre o Schematron da versão do documento, se existir (ver EsquemaXSD).
+// Só as asserções falhadas rejeitam o documento; os reports disparados voltam como avisos.
+func validarComSchematron(esquemas *RegistoEsquemas, xmlString string) (bool, string, []ErroDocumento) {
+	doc, err := libxml2.ParseString(xmlString)
+	if err != nil {
+		return false, "ERRO_XML: XML mal formatado", nil
+	}
+	defer doc.Free()
+
+	erros, aplicado, err := esquemas.ValidarSchematron(doc)
+	if err != nil {
+		return false, "ERRO_SCHEMATRON: " + err.Error(), nil
+	}
+	if !aplicado {
+		return true, "SUCCESS", nil
+	}
+
+	falhadas := 0
+	for _, e := range erros {
+		if e.Severidade == SeveridadeErro {
+			falhadas++
+		}
+	}
+	if falhadas > 0 {
+		return false, fmt.Sprintf("ERRO_SCHEMATRON: %d asserções falhadas", falhadas), erros
+	}
+	return true, "SUCCESS", erros
+}
 
 func main() {
 	godotenv.Load()
 	db := ConnectDB()
 	defer db.Close()
 
+	// "xml-service migrate [status]" só trata do esquema da base de dados e sai
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := comandoMigrate(db, os.Args[2:]); err != nil {
+			log.Fatal("Erro nas migrações: ", err)
+		}
+		return
+	}
+
+	// "xml-service reconstruir-veiculos" regenera a projeção veiculos a partir dos XML guardados
+	if len(os.Args) > 1 && os.Args[1] == "reconstruir-veiculos" {
+		if _, err := AplicarMigracoes(db); err != nil {
+			log.Fatal("Erro nas migrações: ", err)
+		}
+		if err := comandoReconstruirVeiculos(db); err != nil {
+			log.Fatal("Erro ao reconstruir veículos: ", err)
+		}
+		return
+	}
+
+	// Migrações no arranque, exceto com MIGRAR_NO_ARRANQUE=false (aí têm de ser aplicadas com migrate)
+	if migrar, err := strconv.ParseBool(os.Getenv("MIGRAR_NO_ARRANQUE")); err != nil || migrar {
+		if _, err := AplicarMigracoes(db); err != nil {
+			log.Fatal("Erro nas migrações: ", err)
+		}
+	} else {
+		pendentes, err := MigracoesPendentes(db)
+		if err != nil {
+			log.Fatal("Erro ao verificar migrações: ", err)
+		}
+		if len(pendentes) > 0 {
+			log.Fatalf("Esquema da base de dados desatualizado: %d migrações pendentes (xml-service migrate)", len(pendentes))
+		}
+	}
+
+	// Documentos guardados antes da projeção veiculos: gera-a uma vez no arranque
+	if vazia, _ := ProjecaoPorConstruir(db); vazia {
+		if err := comandoReconstruirVeiculos(db); err != nil {
+			log.Fatal("Erro ao reconstruir veículos: ", err)
+		}
+	}
+
+	dirMappers := os.Getenv("MAPPERS_DIR")
+	if dirMappers == "" {
+		dirMappers = "mappers"
+	}
+	mappers, err := CarregarMappers(dirMappers)
+	if err != nil {
+		log.Fatal("Erro ao carregar mappers: ", err)
+	}
+
+	// Um XSD por versão do formato de saída, compilados uma vez e recarregados quando mudam
+	dirEsquemas := os.Getenv("SCHEMAS_DIR")
+	if dirEsquemas == "" {
+		dirEsquemas = "schemas"
+	}
+	versaoXSD := os.Getenv("XSD_VERSAO")
+	if versaoXSD == "" {
+		versaoXSD = "1.0"
+	}
+	esquemas, err := CarregarEsquemas(dirEsquemas, versaoXSD)
+	if err != nil {
+		log.Fatal("Erro ao compilar esquemas XSD: ", err)
+	}
+	if err := esquemas.Observar(); err != nil {
+		log.Println("! Não foi possível observar os esquemas XSD, alterações exigem restart:", err)
+	}
+	// XSD do relatório de diferenças entre uploads; numa subpasta para não contar como versão
+	esquemaDelta, err := CarregarEsquema(filepath.Join(dirEsquemas, "delta", "delta.xsd"))
+	if err != nil {
+		log.Fatal("Erro ao compilar XSD do delta: ", err)
+	}
+
+	// Regras de negócio aplicadas a cada veículo
+	ficheiroRegras := os.Getenv("REGRAS_FICHEIRO")
+	if ficheiroRegras == "" {
+		ficheiroRegras = "regras.yaml"
+	}
+	regras, err := CarregarRegras(ficheiroRegras)
+	if err != nil {
+		log.Fatal("Erro ao carregar regras de negócio: ", err)
+	}
+
+	// Observação que conta quando o mesmo IDInterno aparece em vários uploads
+	politica, err := ParsePoliticaVeiculos(os.Getenv("POLITICA_VEICULOS"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Pool de workers para o pipeline de upload (WORKERS, FILA_MAX)
+	pool := NovoPoolWorkers(db, mappers, esquemas, esquemaDelta, regras, envInt("WORKERS", 4), envInt("FILA_MAX", 50))
+	retryAfter := envInt("RETRY_AFTER", 30)
+
+	// Entregas de webhook assinadas, com novas tentativas (WEBHOOK_TIMEOUT, WEBHOOK_MAX_TENTATIVAS, WEBHOOK_SECRET).
+	// Enviar sem assinatura tem de ser pedido explicitamente com WEBHOOK_SEM_ASSINATURA=true.
+	segredoWebhook := os.Getenv("WEBHOOK_SECRET")
+	if semAssinatura, _ := strconv.ParseBool(os.Getenv("WEBHOOK_SEM_ASSINATURA")); segredoWebhook == "" && !semAssinatura {
+		log.Fatal("WEBHOOK_SECRET não definido (WEBHOOK_SEM_ASSINATURA=true para enviar os webhooks sem assinatura)")
+	}
+	entregador := NovoEntregadorWebhooks(db, time.Duration(envInt("WEBHOOK_TIMEOUT", 10))*time.Second, envInt("WEBHOOK_MAX_TENTATIVAS", 8), segredoWebhook)
+
 	// 1. Servidor gRPC (Requisito 8d)
 	go func() {
 		lis, err := net.Listen("tcp", ":50051")
@@ -96,7 +335,7 @@ func main() {
 			log.Fatalf("Falha gRPC: %v", err)
 		}
 		s := grpc.NewServer()
-		pb.RegisterBIQueryServiceServer(s, &server{db: db})
+		pb.RegisterBIQueryServiceServer(s, &server{db: db, politica: politica})
 		fmt.Println("\nServidor gRPC ON na porta 50051")
 		if err := s.Serve(lis); err != nil {
 			log.Fatalf("Erro gRPC: %v", err)
@@ -107,8 +346,31 @@ func main() {
 	http.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
 		reqID := r.FormValue("requestId")
 		mapperVer := r.FormValue("mapper")
+		webhookVersao, _ := strconv.Atoi(r.FormValue("webhookVersao"))
 		webhookURL := r.FormValue("webhookUrl")
 		fileName := r.FormValue("fileName")
+		versaoXsd := r.FormValue("versaoXsd")
+		fonte := r.FormValue("fonte") // Origem do stock (stand, portal); por defeito o mapper
+
+		if reqID == "" {
+			http.Error(w, "requestId em falta", 400)
+			return
+		}
+
+		// O mapper pedido define como as colunas do CSV viram VeiculoXML
+		if _, ok := mappers.Obter(mapperVer); !ok {
+			http.Error(w, "Mapper desconhecido: "+mapperVer, 400)
+			return
+		}
+
+		// Versão do formato de saída (RelatorioVeiculos/@Versao); por defeito XSD_VERSAO
+		if versaoXsd == "" {
+			versaoXsd = esquemas.Defeito()
+		}
+		if _, ok := esquemas.Obter(versaoXsd); !ok {
+			http.Error(w, "Versão de esquema desconhecida: "+versaoXsd, 400)
+			return
+		}
 
 		file, _, err := r.FormFile("csvFile")
 		if err != nil {
@@ -120,77 +382,71 @@ func main() {
 		buf.ReadFrom(file)
 		file.Close()
 
-		go func(csvData []byte, id, fname, wURL, mVer string) {
-			reader := csv.NewReader(bytes.NewReader(csvData))
-			reader.LazyQuotes = true
-			linhas, err := reader.ReadAll()
+		// Idempotência: o mesmo requestId ou o mesmo CSV devolvem o job original (exceto com force=true)
+		soma := sha256.Sum256(buf.Bytes())
+		hash := hex.EncodeToString(soma[:])
+		if force, _ := strconv.ParseBool(r.FormValue("force")); !force {
+			original, err := FindJobRepetido(db, reqID, hash)
 			if err != nil {
-				callWebhook(wURL, id, "ERRO_CSV", fname)
+				http.Error(w, "Erro ao registar job", 500)
 				return
 			}
-
-			// --- AJUSTE AQUI: Preenchimento conforme o exemplo do professor ---
-			relatorio := ListaVeiculos{
-				DataGeracao: time.Now().Format("2006-01-02"),
-				Versao:      "1.0", // Versão do esquema
-				Stock:       []VeiculoXML{},
-			}
-			// Usando o ID dinâmico nos atributos de configuração
-			relatorio.Configuracao.ValidadoPor = "XML_Service_ID_" + id
-			relatorio.Configuracao.Requisitante = "Processador_ID_" + id
-
-			for i, col := range linhas {
-				if i == 0 || len(col) < 13 { continue }
-
-				v := VeiculoXML{}
-				v.Identificador = col[0]
-				v.Identificacao.Designacao = col[1]
-				v.Identificacao.Preco, _ = strconv.ParseFloat(col[2], 64)
-				v.Identificacao.Ano, _ = strconv.Atoi(col[3])
-				v.Identificacao.CategoriaVeiculo = col[10]
-				v.DetalhesTecnicos.Cilindrada, _ = strconv.Atoi(col[7])
-				v.DetalhesTecnicos.PotenciaMotor, _ = strconv.Atoi(col[8])
-				v.DetalhesTecnicos.TipoCombustivel = col[5]
-				v.DetalhesTecnicos.TipoTransmissao = col[9]
-				v.HistoricoUso.Kilometragem, _ = strconv.Atoi(col[4])
-				v.Geografia.Cidade = col[6]
-				v.Geografia.GPS.Lat, _ = strconv.ParseFloat(col[11], 64)
-				v.Geografia.GPS.Lon, _ = strconv.ParseFloat(col[12], 64)
-
-				relatorio.Stock = append(relatorio.Stock, v)
-			}
-
-			// Validação e Persistência
-			ok, status := validar(relatorio)
-			if ok {
-				// 2. Gerar o XML
-				xmlBytes, _ := xml.MarshalIndent(relatorio, "", "  ")
-				xmlFinal := string(xml.Header) + string(xmlBytes)
-
-				// 3. Validação XSD (O "Segurança" do contrato)
-				xsdOk, xsdMsg := validarComXSD(xmlFinal)
-				if !xsdOk {
-					status = xsdMsg
-					log.Println("Rejeitado pelo XSD:", xsdMsg)
-				} else {
-					// 4. Só persiste se passar no XSD
-					err := SaveXML(db, xmlFinal, mVer)
-					if err != nil {
-						status = "ERRO_PERSISTENCIA"
-					} else {
-						status = "SUCCESS"
-					}
-				}
+			if original != nil {
+				log.Printf("Upload %s repetido do job %s, não volta a ser processado\n", reqID, original.RequestId)
+				responderUpload(w, http.StatusOK, original.RequestId, original.Estado, original.StatusFinal, true)
+				return
 			}
+		}
 
-			if wURL != "" {
-				callWebhook(wURL, id, status, fname)
-			}
-		}(buf.Bytes(), reqID, fileName, webhookURL, mapperVer)
+		// O pedido fica gravado na fila antes de responder 202, para sobreviver a um restart
+		aceite, err := pool.Submeter(PedidoUpload{
+			RequestId:     reqID,
+			FileName:      fileName,
+			WebhookURL:    webhookURL,
+			MapperVersion: mapperVer,
+			CSV:           buf.Bytes(),
+			CsvSha256:     hash,
+			WebhookVersao: webhookVersao,
+			VersaoXSD:     versaoXsd,
+			Fonte:         fonte,
+		})
+		if err == ErrPedidoEmCurso {
+			http.Error(w, "O pedido "+reqID+" ainda está a ser processado", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Println("Erro ao enfileirar pedido:", err)
+			http.Error(w, "Erro ao registar job", 500)
+			return
+		}
+		if !aceite {
+			// Fila cheia: o job não chega a existir e o cliente tenta mais tarde
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			http.Error(w, "Fila de processamento cheia", http.StatusTooManyRequests)
+			return
+		}
 
-		w.WriteHeader(http.StatusAccepted)
+		responderUpload(w, http.StatusAccepted, reqID, EstadoQueued, "", false)
 	})
 
+	// 3. Estado de um pedido de upload
+	http.HandleFunc("GET /jobs/{requestId}", handlerJob(db))
+
+	// 4. Subscrições de webhooks por evento (só com ADMIN_TOKEN)
+	registarRotasSubscricoes(db, os.Getenv("ADMIN_TOKEN"))
+
+	// 5. Métricas da fila de processamento
+	http.HandleFunc("GET /metrics", pool.handlerMetricas)
+
+	// 6. Histórico de entregas de webhooks e reenvio manual (só com ADMIN_TOKEN)
+	entregador.registarRotasAdmin(os.Getenv("ADMIN_TOKEN"))
+
+	// 7. Diferenças de cada documento para o upload anterior da mesma fonte (JSON ou XML)
+	registarRotasDelta(db)
+
+	// 8. Listagem, metadados e XML original dos documentos guardados
+	registarRotasDocumentos(db)
+
 	fmt.Println("\nServiço XML ON na porta 8080")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
\ No newline at end of file
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Mapper é a definição declarativa (JSON/YAML) de como uma linha do CSV vira um VeiculoXML.
+// Cada ficheiro na pasta de mappers corresponde a uma versão.
+type Mapper struct {
+	Versao    string        `json:"versao" yaml:"versao"`
+	Descricao string        `json:"descricao" yaml:"descricao"`
+	Campos    []CampoMapper `json:"campos" yaml:"campos"`
+}
+
+type CampoMapper struct {
+	Origem         string   `json:"origem" yaml:"origem"`   // Nome da coluna no cabeçalho do CSV
+	Aliases        []string `json:"aliases" yaml:"aliases"` // Nomes alternativos da coluna
+	Destino        string   `json:"destino" yaml:"destino"` // Campo XML (ex: Identificacao/Preco)
+	Tipo           string   `json:"tipo" yaml:"tipo"`       // texto | inteiro | decimal
+	Defeito        string   `json:"defeito" yaml:"defeito"` // Usado quando a célula de um campo opcional vem vazia
+	Obrigatorio    bool     `json:"obrigatorio" yaml:"obrigatorio"`
+	Transformacoes []string `json:"transformacoes" yaml:"transformacoes"`
+}
+
+// Campos de VeiculoXML que um mapper pode preencher, pelo caminho XML
+var destinosVeiculo = map[string]func(v *VeiculoXML, valor interface{}){
+	"@IDInterno":                       func(v *VeiculoXML, x interface{}) { v.Identificador = comoTexto(x) },
+	"Identificacao/Designacao":         func(v *VeiculoXML, x interface{}) { v.Identificacao.Designacao = comoTexto(x) },
+	"Identificacao/Preco":              func(v *VeiculoXML, x interface{}) { v.Identificacao.Preco = numeroXML(comoDecimal(x)) },
+	"Identificacao/Ano":                func(v *VeiculoXML, x interface{}) { v.Identificacao.Ano = comoInteiro(x) },
+	"Identificacao/Categoria":          func(v *VeiculoXML, x interface{}) { v.Identificacao.CategoriaVeiculo = comoTexto(x) },
+	"DetalhesTecnicos/Cilindrada":      func(v *VeiculoXML, x interface{}) { v.DetalhesTecnicos.Cilindrada = comoInteiro(x) },
+	"DetalhesTecnicos/PotenciaMotor":   func(v *VeiculoXML, x interface{}) { v.DetalhesTecnicos.PotenciaMotor = comoInteiro(x) },
+	"DetalhesTecnicos/TipoCombustivel": func(v *VeiculoXML, x interface{}) { v.DetalhesTecnicos.TipoCombustivel = comoTexto(x) },
+	"DetalhesTecnicos/TipoTransmissao": func(v *VeiculoXML, x interface{}) { v.DetalhesTecnicos.TipoTransmissao = comoTexto(x) },
+	"HistoricoUso/Kilometragem":        func(v *VeiculoXML, x interface{}) { v.HistoricoUso.Kilometragem = comoInteiro(x) },
+	"Geografia/Cidade":                 func(v *VeiculoXML, x interface{}) { v.Geografia.Cidade = comoTexto(x) },
+	"Geografia/PosicionamentoGPS/@Lat": func(v *VeiculoXML, x interface{}) { v.Geografia.GPS.Lat = numeroXML(comoDecimal(x)) },
+	"Geografia/PosicionamentoGPS/@Lon": func(v *VeiculoXML, x interface{}) { v.Geografia.GPS.Lon = numeroXML(comoDecimal(x)) },
+}
+
+var naoDigitos = regexp.MustCompile(`\D`)
+
+var transformacoes = map[string]func(string) string{
+	"trim":            strings.TrimSpace,
+	"maiusculas":      strings.ToUpper,
+	"minusculas":      strings.ToLower,
+	"apenas_digitos":  func(s string) string { return naoDigitos.ReplaceAllString(s, "") },
+	"virgula_decimal": func(s string) string { return strings.Replace(s, ",", ".", 1) },
+}
+
+// RegistoMappers guarda os mappers carregados, indexados pela versão
+type RegistoMappers struct {
+	mappers map[string]*Mapper
+}
+
+// CarregarMappers lê todos os ficheiros .json/.yaml/.yml da pasta indicada.
+// Falha se algum ficheiro for inválido ou se duas definições tiverem a mesma versão.
+func CarregarMappers(dir string) (*RegistoMappers, error) {
+	ficheiros, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	reg := &RegistoMappers{mappers: map[string]*Mapper{}}
+	for _, f := range ficheiros {
+		ext := strings.ToLower(filepath.Ext(f.Name()))
+		if f.IsDir() || (ext != ".json" && ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		conteudo, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m := &Mapper{}
+		if ext == ".json" {
+			err = json.Unmarshal(conteudo, m)
+		} else {
+			err = yaml.Unmarshal(conteudo, m)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name(), err)
+		}
+		if err := m.verificar(); err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name(), err)
+		}
+		if _, existe := reg.mappers[m.Versao]; existe {
+			return nil, fmt.Errorf("%s: versão %s repetida", f.Name(), m.Versao)
+		}
+
+		m.juntarAliases(aliasesCSV())
+		reg.mappers[m.Versao] = m
+	}
+
+	if len(reg.mappers) == 0 {
+		return nil, fmt.Errorf("nenhum mapper encontrado em %s", dir)
+	}
+	return reg, nil
+}
+
+// Obter devolve o mapper da versão pedida
+func (r *RegistoMappers) Obter(versao string) (*Mapper, bool) {
+	m, ok := r.mappers[versao]
+	return m, ok
+}
+
+// verificar garante que o mapper só usa destinos, tipos e transformações conhecidos
+func (m *Mapper) verificar() error {
+	if m.Versao == "" {
+		return fmt.Errorf("mapper sem versão")
+	}
+	for _, c := range m.Campos {
+		if c.Origem == "" {
+			return fmt.Errorf("campo sem origem")
+		}
+		if _, ok := destinosVeiculo[c.Destino]; !ok {
+			return fmt.Errorf("destino desconhecido: %s", c.Destino)
+		}
+		switch c.Tipo {
+		case "", "texto", "inteiro", "decimal":
+		default:
+			return fmt.Errorf("tipo desconhecido em %s: %s", c.Origem, c.Tipo)
+		}
+		for _, t := range c.Transformacoes {
+			if _, ok := transformacoes[t]; !ok {
+				return fmt.Errorf("transformação desconhecida em %s: %s", c.Origem, t)
+			}
+		}
+	}
+	return nil
+}
+
+// juntarAliases acrescenta os aliases configurados por ambiente (CSV_ALIASES)
+func (m *Mapper) juntarAliases(extra map[string][]string) {
+	for i := range m.Campos {
+		m.Campos[i].Aliases = append(m.Campos[i].Aliases, extra[normalizarCabecalho(m.Campos[i].Origem)]...)
+	}
+}
+
+// Colunas devolve as colunas que o mapper espera encontrar no cabeçalho
+func (m *Mapper) Colunas() []ColunaCSV {
+	colunas := make([]ColunaCSV, 0, len(m.Campos))
+	for _, c := range m.Campos {
+		colunas = append(colunas, ColunaCSV{Nome: c.Origem, Aliases: c.Aliases, Obrigatoria: c.Obrigatorio})
+	}
+	return colunas
+}
+
+// MapearLinha aplica as transformações e conversões de tipo a uma linha do CSV.
+// Cada célula que não respeita o tipo ou que falta num campo obrigatório gera um ErroCelula.
+func (m *Mapper) MapearLinha(numLinha int, linha []string, colunas MapaColunas) (VeiculoXML, []ErroCelula) {
+	v := VeiculoXML{}
+	var erros []ErroCelula
+	for _, c := range m.Campos {
+		original := colunas.valor(linha, c.Origem)
+		bruto := original
+		for _, t := range c.Transformacoes {
+			bruto = transformacoes[t](bruto)
+		}
+		if bruto == "" {
+			// Num campo obrigatório a célula vazia é um erro da linha, mesmo que o mapper tenha defeito
+			if c.Obrigatorio {
+				erros = append(erros, ErroCelula{Linha: numLinha, Coluna: c.Origem, Valor: original, Motivo: "valor obrigatório em falta"})
+				continue
+			}
+			bruto = c.Defeito
+		}
+
+		valor, err := converter(bruto, c.Tipo)
+		if err != nil {
+			erros = append(erros, ErroCelula{Linha: numLinha, Coluna: c.Origem, Valor: original, Motivo: "não é um valor " + c.Tipo + " válido"})
+			continue
+		}
+		destinosVeiculo[c.Destino](&v, valor)
+	}
+	return v, erros
+}
+
+// converter passa o texto da célula para o tipo declarado no mapper
+func converter(bruto string, tipo string) (interface{}, error) {
+	switch tipo {
+	case "inteiro":
+		return strconv.Atoi(bruto)
+	case "decimal":
+		return strconv.ParseFloat(bruto, 64)
+	default:
+		return bruto, nil
+	}
+}
+
+func comoTexto(x interface{}) string {
+	switch v := x.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+func comoInteiro(x interface{}) int {
+	switch v := x.(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(v)
+		return n
+	}
+	return 0
+}
+
+func comoDecimal(x interface{}) float64 {
+	switch v := x.(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	}
+	return 0
+}
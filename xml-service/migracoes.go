@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// As migrações vão dentro do binário: migracoes/NNN_descricao.sql, aplicadas por ordem de NNN.
+// Um ficheiro aplicado nunca se altera; uma mudança ao esquema é sempre um ficheiro novo.
+//
+//go:embed migracoes/*.sql
+var ficheirosMigracoes embed.FS
+
+// chaveMigracoes identifica o pg_advisory_lock que impede duas réplicas de migrar ao mesmo tempo
+const chaveMigracoes = 7203118
+
+// Migracao é um ficheiro de migrações embebido no binário
+type Migracao struct {
+	Versao int
+	Nome   string
+	SQL    string
+}
+
+// MigracaoAplicada é uma linha da tabela schema_version
+type MigracaoAplicada struct {
+	Versao        int
+	Nome          string
+	DataAplicacao string
+}
+
+// lerMigracoes devolve as migrações embebidas, por ordem de versão
+func lerMigracoes() ([]Migracao, error) {
+	ficheiros, err := ficheirosMigracoes.ReadDir("migracoes")
+	if err != nil {
+		return nil, err
+	}
+
+	migracoes := []Migracao{}
+	versoes := map[int]string{}
+	for _, f := range ficheiros {
+		numero, nome, ok := strings.Cut(strings.TrimSuffix(f.Name(), ".sql"), "_")
+		versao, err := strconv.Atoi(numero)
+		if !ok || err != nil || versao <= 0 {
+			return nil, fmt.Errorf("nome de migração inválido: %s (esperado NNN_descricao.sql)", f.Name())
+		}
+		if outro, repetida := versoes[versao]; repetida {
+			return nil, fmt.Errorf("migrações %s e %s com a mesma versão", outro, f.Name())
+		}
+		versoes[versao] = f.Name()
+
+		conteudo, err := ficheirosMigracoes.ReadFile(path.Join("migracoes", f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migracoes = append(migracoes, Migracao{Versao: versao, Nome: nome, SQL: string(conteudo)})
+	}
+	sort.Slice(migracoes, func(i, j int) bool { return migracoes[i].Versao < migracoes[j].Versao })
+	return migracoes, nil
+}
+
+// AplicarMigracoes cria a schema_version se não existir e aplica as migrações em falta, cada uma
+// na sua transação. Devolve a versão do esquema no fim.
+func AplicarMigracoes(db *sql.DB) (int, error) {
+	migracoes, err := lerMigracoes()
+	if err != nil {
+		return 0, err
+	}
+
+	// O advisory lock pertence à sessão, por isso tudo corre na mesma ligação
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, chaveMigracoes); err != nil {
+		return 0, err
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, chaveMigracoes)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (
+		versao         INTEGER PRIMARY KEY,
+		nome           TEXT NOT NULL,
+		data_aplicacao TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return 0, err
+	}
+
+	atual, err := versaoEsquema(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if n := len(migracoes); n > 0 && atual > migracoes[n-1].Versao {
+		// Uma réplica mais antiga a arrancar depois de uma mais nova: não mexe no esquema
+		log.Printf("! Esquema da base de dados na versão %d, mais recente do que este binário (%d)\n", atual, migracoes[n-1].Versao)
+		return atual, nil
+	}
+
+	for _, m := range migracoes {
+		if m.Versao <= atual {
+			continue
+		}
+		if err := aplicarMigracao(ctx, conn, m); err != nil {
+			return atual, fmt.Errorf("migração %03d_%s: %v", m.Versao, m.Nome, err)
+		}
+		atual = m.Versao
+		log.Printf("Migração %03d_%s aplicada\n", m.Versao, m.Nome)
+	}
+	return atual, nil
+}
+
+func aplicarMigracao(ctx context.Context, conn *sql.Conn, m Migracao) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Sem parâmetros, o lib/pq envia o ficheiro inteiro de uma vez (várias instruções)
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_version (versao, nome) VALUES ($1, $2)`, m.Versao, m.Nome); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func versaoEsquema(ctx context.Context, conn *sql.Conn) (int, error) {
+	var versao int
+	err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(versao), 0) FROM schema_version`).Scan(&versao)
+	return versao, err
+}
+
+// MigracoesPendentes devolve as migrações embebidas que ainda não foram aplicadas
+func MigracoesPendentes(db *sql.DB) ([]Migracao, error) {
+	migracoes, err := lerMigracoes()
+	if err != nil {
+		return nil, err
+	}
+	aplicadas, err := ListMigracoesAplicadas(db)
+	if err != nil {
+		return nil, err
+	}
+	feitas := map[int]bool{}
+	for _, a := range aplicadas {
+		feitas[a.Versao] = true
+	}
+
+	pendentes := []Migracao{}
+	for _, m := range migracoes {
+		if !feitas[m.Versao] {
+			pendentes = append(pendentes, m)
+		}
+	}
+	return pendentes, nil
+}
+
+// ListMigracoesAplicadas lê a schema_version (vazia se a base de dados nunca foi migrada)
+func ListMigracoesAplicadas(db *sql.DB) ([]MigracaoAplicada, error) {
+	var existe bool
+	if err := db.QueryRow(`SELECT to_regclass('schema_version') IS NOT NULL`).Scan(&existe); err != nil {
+		log.Println("Erro ao ler schema_version:", err)
+		return nil, err
+	}
+	aplicadas := []MigracaoAplicada{}
+	if !existe {
+		return aplicadas, nil
+	}
+
+	rows, err := db.Query(`SELECT versao, nome, to_char(data_aplicacao, 'YYYY-MM-DD HH24:MI:SS') FROM schema_version ORDER BY versao`)
+	if err != nil {
+		log.Println("Erro ao ler schema_version:", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a MigracaoAplicada
+		if err := rows.Scan(&a.Versao, &a.Nome, &a.DataAplicacao); err != nil {
+			return nil, err
+		}
+		aplicadas = append(aplicadas, a)
+	}
+	return aplicadas, rows.Err()
+}
+
+// comandoMigrate trata "xml-service migrate [status]": aplica as migrações (ou mostra o estado) e sai
+func comandoMigrate(db *sql.DB, args []string) error {
+	if len(args) > 0 && args[0] == "status" {
+		aplicadas, err := ListMigracoesAplicadas(db)
+		if err != nil {
+			return err
+		}
+		pendentes, err := MigracoesPendentes(db)
+		if err != nil {
+			return err
+		}
+		for _, a := range aplicadas {
+			fmt.Printf("%03d_%s\taplicada em %s\n", a.Versao, a.Nome, a.DataAplicacao)
+		}
+		for _, m := range pendentes {
+			fmt.Printf("%03d_%s\tpendente\n", m.Versao, m.Nome)
+		}
+		return nil
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("uso: xml-service migrate [status]")
+	}
+
+	versao, err := AplicarMigracoes(db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Esquema da base de dados na versão %d\n", versao)
+	return nil
+}
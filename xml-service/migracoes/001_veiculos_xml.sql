@@ -0,0 +1,19 @@
+-- Documentos XML validados, um por upload
+CREATE TABLE IF NOT EXISTS veiculos_xml (
+    id             SERIAL PRIMARY KEY,
+    xml_documento  XML NOT NULL,
+    data_criacao   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    mapper_version TEXT
+);
+
+-- Bases criadas à mão ou pelo tabelas.sql antes das migrações: a tabela já existe mas pode não ter todas as colunas
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+                   WHERE table_schema = current_schema() AND table_name = 'veiculos_xml' AND column_name = 'id') THEN
+        ALTER TABLE veiculos_xml ADD COLUMN id SERIAL PRIMARY KEY;
+    END IF;
+END $$;
+ALTER TABLE veiculos_xml ADD COLUMN IF NOT EXISTS mapper_version TEXT;
+
+CREATE INDEX IF NOT EXISTS veiculos_xml_data_criacao_idx ON veiculos_xml (data_criacao);
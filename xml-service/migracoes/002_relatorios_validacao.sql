@@ -0,0 +1,14 @@
+-- Relatório de validação linha a linha de cada pedido (um por tentativa de processamento)
+CREATE TABLE IF NOT EXISTS relatorios_validacao (
+    id                BIGSERIAL PRIMARY KEY,
+    request_id        TEXT NOT NULL,
+    file_name         TEXT NOT NULL DEFAULT '',
+    resultado         TEXT NOT NULL,
+    linhas_lidas      INTEGER NOT NULL DEFAULT 0,
+    linhas_aceites    INTEGER NOT NULL DEFAULT 0,
+    linhas_rejeitadas INTEGER NOT NULL DEFAULT 0,
+    erros             JSONB NOT NULL DEFAULT '[]',
+    data_criacao      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS relatorios_validacao_request_idx ON relatorios_validacao (request_id, data_criacao DESC);
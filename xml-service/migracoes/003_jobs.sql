@@ -0,0 +1,29 @@
+-- Estado persistente de cada pedido de /upload
+CREATE TABLE IF NOT EXISTS jobs (
+    request_id        TEXT PRIMARY KEY,
+    file_name         TEXT NOT NULL DEFAULT '',
+    mapper_version    TEXT NOT NULL DEFAULT '',
+    csv_sha256        TEXT,
+    estado            TEXT NOT NULL,
+    status_final      TEXT,
+    linhas_lidas      INTEGER NOT NULL DEFAULT 0,
+    linhas_aceites    INTEGER NOT NULL DEFAULT 0,
+    linhas_rejeitadas INTEGER NOT NULL DEFAULT 0,
+    documento_id      INTEGER REFERENCES veiculos_xml (id) ON DELETE SET NULL,
+    data_criacao      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    data_atualizacao  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    data_conclusao    TIMESTAMPTZ
+);
+
+-- Bases criadas pelo tabelas.sql de versões anteriores: a tabela pode não ter as colunas mais recentes
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS csv_sha256 TEXT;
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+                   WHERE table_schema = current_schema() AND table_name = 'jobs' AND column_name = 'documento_id') THEN
+        ALTER TABLE jobs ADD COLUMN documento_id INTEGER REFERENCES veiculos_xml (id) ON DELETE SET NULL;
+    END IF;
+END $$;
+
+-- Deteção de uploads repetidos pelo conteúdo (FindJobRepetido)
+CREATE INDEX IF NOT EXISTS jobs_csv_sha256_idx ON jobs (csv_sha256, data_criacao DESC);
@@ -0,0 +1,17 @@
+-- Fila persistente do pool de workers; o pedido sai da fila quando o processamento termina
+CREATE TABLE IF NOT EXISTS fila_uploads (
+    request_id     TEXT PRIMARY KEY,
+    file_name      TEXT NOT NULL DEFAULT '',
+    webhook_url    TEXT NOT NULL DEFAULT '',
+    webhook_versao INTEGER NOT NULL DEFAULT 0,
+    mapper_version TEXT NOT NULL DEFAULT '',
+    csv            BYTEA NOT NULL,
+    estado         TEXT NOT NULL DEFAULT 'pendente' CHECK (estado IN ('pendente', 'em_curso')),
+    tentativas     INTEGER NOT NULL DEFAULT 0,
+    reclamado_por  TEXT,
+    reclamado_em   TIMESTAMPTZ,
+    data_criacao   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+ALTER TABLE fila_uploads ADD COLUMN IF NOT EXISTS webhook_versao INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS fila_uploads_estado_idx ON fila_uploads (estado, data_criacao);
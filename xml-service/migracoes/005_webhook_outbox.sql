@@ -0,0 +1,27 @@
+-- Outbox das entregas de webhook; o EntregadorWebhooks reclama as pendentes vencidas
+CREATE TABLE IF NOT EXISTS webhook_outbox (
+    id                BIGSERIAL PRIMARY KEY,
+    delivery_id       TEXT NOT NULL,
+    subscricao_id     BIGINT, -- Nulo para o webhookUrl do upload; sem FK para a entrega falhar se a subscrição for apagada
+    evento            TEXT NOT NULL,
+    request_id        TEXT NOT NULL,
+    url               TEXT NOT NULL,
+    payload           TEXT NOT NULL,
+    estado            TEXT NOT NULL,
+    tentativas        INTEGER NOT NULL DEFAULT 0,
+    proxima_tentativa TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ultimo_erro       TEXT,
+    data_criacao      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    data_entrega      TIMESTAMPTZ
+);
+
+-- Outbox criada antes das assinaturas (delivery_id) e das subscrições (subscricao_id, evento)
+ALTER TABLE webhook_outbox ADD COLUMN IF NOT EXISTS delivery_id TEXT;
+UPDATE webhook_outbox SET delivery_id = md5(random()::text || id::text) WHERE delivery_id IS NULL;
+ALTER TABLE webhook_outbox ALTER COLUMN delivery_id SET NOT NULL;
+ALTER TABLE webhook_outbox ADD COLUMN IF NOT EXISTS subscricao_id BIGINT;
+ALTER TABLE webhook_outbox ADD COLUMN IF NOT EXISTS evento TEXT NOT NULL DEFAULT 'job.completed';
+ALTER TABLE webhook_outbox ALTER COLUMN evento DROP DEFAULT;
+
+CREATE INDEX IF NOT EXISTS webhook_outbox_pendentes_idx ON webhook_outbox (estado, proxima_tentativa);
+CREATE INDEX IF NOT EXISTS webhook_outbox_request_idx ON webhook_outbox (request_id);
@@ -0,0 +1,12 @@
+-- Subscrições de webhooks por evento, com filtros opcionais
+CREATE TABLE IF NOT EXISTS subscricoes (
+    id               BIGSERIAL PRIMARY KEY,
+    url              TEXT NOT NULL,
+    eventos          TEXT[] NOT NULL,
+    segredo          TEXT NOT NULL,
+    filtros          JSONB NOT NULL DEFAULT '{}',
+    ativa            BOOLEAN NOT NULL DEFAULT true,
+    data_criacao     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    data_atualizacao TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
@@ -0,0 +1,15 @@
+-- Histórico de cada tentativa de entrega de webhook (automática ou reenvio manual)
+CREATE TABLE IF NOT EXISTS webhook_tentativas (
+    id              BIGSERIAL PRIMARY KEY,
+    entrega_id      BIGINT NOT NULL REFERENCES webhook_outbox (id) ON DELETE CASCADE,
+    tentativa       INTEGER NOT NULL,
+    manual          BOOLEAN NOT NULL DEFAULT false,
+    corpo           TEXT NOT NULL,
+    codigo_resposta INTEGER,
+    resposta        TEXT,
+    latencia_ms     BIGINT NOT NULL DEFAULT 0,
+    erro            TEXT,
+    data_tentativa  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_tentativas_entrega_idx ON webhook_tentativas (entrega_id, id);
@@ -0,0 +1,3 @@
+-- Versão do XSD (RelatorioVeiculos/@Versao) com que cada documento foi pedido e validado
+ALTER TABLE veiculos_xml ADD COLUMN IF NOT EXISTS versao_xsd TEXT NOT NULL DEFAULT '1.0';
+ALTER TABLE fila_uploads ADD COLUMN IF NOT EXISTS versao_xsd TEXT NOT NULL DEFAULT '1.0';
@@ -0,0 +1,4 @@
+-- Resultado das regras de negócio por veículo e erros do XSD e do Schematron sobre o documento
+ALTER TABLE relatorios_validacao ADD COLUMN IF NOT EXISTS veiculos JSONB;
+ALTER TABLE relatorios_validacao ADD COLUMN IF NOT EXISTS erros_xsd JSONB;
+ALTER TABLE relatorios_validacao ADD COLUMN IF NOT EXISTS erros_schematron JSONB;
@@ -0,0 +1,24 @@
+-- Projeção relacional do Stock de cada documento, mantida no SaveXML e usada pelas estatísticas gRPC.
+-- Pode ser regenerada a partir de veiculos_xml com "xml-service reconstruir-veiculos".
+CREATE TABLE IF NOT EXISTS veiculos (
+    id             BIGSERIAL PRIMARY KEY,
+    documento_id   INTEGER NOT NULL REFERENCES veiculos_xml (id) ON DELETE CASCADE,
+    posicao        INTEGER NOT NULL, -- Ordem do Veiculo no Stock, a partir de 0
+    id_interno     TEXT NOT NULL,
+    designacao     TEXT,
+    categoria      TEXT,
+    preco          NUMERIC,
+    ano            INTEGER,
+    cilindrada     INTEGER,
+    potencia       INTEGER,
+    combustivel    TEXT,
+    transmissao    TEXT,
+    kms            NUMERIC,
+    cidade         TEXT,
+    lat            DOUBLE PRECISION,
+    lon            DOUBLE PRECISION,
+    data_documento TIMESTAMPTZ NOT NULL, -- data_criacao do documento de origem
+    UNIQUE (documento_id, posicao)
+);
+
+CREATE INDEX IF NOT EXISTS veiculos_id_interno_idx ON veiculos (id_interno, data_documento DESC);
@@ -0,0 +1,25 @@
+-- Resumo de cada IDInterno ao longo dos uploads: primeira e última vez que foi visto
+CREATE TABLE IF NOT EXISTS veiculos_resumo (
+    id_interno         TEXT PRIMARY KEY,
+    primeiro_documento INTEGER NOT NULL,
+    primeira_vez       TIMESTAMPTZ NOT NULL,
+    ultimo_documento   INTEGER NOT NULL,
+    ultima_vez         TIMESTAMPTZ NOT NULL,
+    observacoes        INTEGER NOT NULL DEFAULT 1,
+    preco              NUMERIC, -- Últimos valores observados, para detetar a alteração seguinte
+    kms                NUMERIC
+);
+
+-- Linha do tempo do Preco e da Kilometragem: a primeira observação e cada alteração
+CREATE TABLE IF NOT EXISTS veiculos_historico (
+    id              BIGSERIAL PRIMARY KEY,
+    id_interno      TEXT NOT NULL,
+    documento_id    INTEGER NOT NULL REFERENCES veiculos_xml (id) ON DELETE CASCADE,
+    preco           NUMERIC,
+    kms             NUMERIC,
+    preco_anterior  NUMERIC,
+    kms_anterior    NUMERIC,
+    data_observacao TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS veiculos_historico_id_interno_idx ON veiculos_historico (id_interno, data_observacao, id);
@@ -0,0 +1,25 @@
+-- Origem do stock (campo fonte do /upload; por defeito o mapper). Cada upload é o stock completo
+-- da sua fonte e só é comparado com o anterior da mesma fonte.
+ALTER TABLE veiculos_xml ADD COLUMN IF NOT EXISTS fonte TEXT;
+UPDATE veiculos_xml SET fonte = COALESCE(mapper_version, '') WHERE fonte IS NULL;
+ALTER TABLE veiculos_xml ALTER COLUMN fonte SET DEFAULT '';
+ALTER TABLE veiculos_xml ALTER COLUMN fonte SET NOT NULL;
+
+ALTER TABLE fila_uploads ADD COLUMN IF NOT EXISTS fonte TEXT NOT NULL DEFAULT '';
+
+-- Períodos em que cada veículo esteve anunciado numa fonte. Um período aberto (fim nulo) é um
+-- anúncio ativo; fecha quando o veículo falta no upload seguinte da fonte (provavelmente vendido).
+-- Se voltar a aparecer, abre um período novo marcado como reanúncio.
+CREATE TABLE IF NOT EXISTS anuncios (
+    id               BIGSERIAL PRIMARY KEY,
+    fonte            TEXT NOT NULL,
+    id_interno       TEXT NOT NULL,
+    inicio           TIMESTAMPTZ NOT NULL,
+    documento_inicio INTEGER NOT NULL REFERENCES veiculos_xml (id) ON DELETE CASCADE,
+    fim              TIMESTAMPTZ,
+    documento_fim    INTEGER REFERENCES veiculos_xml (id) ON DELETE SET NULL,
+    reanuncio        BOOLEAN NOT NULL DEFAULT false
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS anuncios_ativos_idx ON anuncios (fonte, id_interno) WHERE fim IS NULL;
+CREATE INDEX IF NOT EXISTS anuncios_id_interno_idx ON anuncios (id_interno, inicio DESC);
@@ -0,0 +1,13 @@
+-- Diferenças de cada documento para o anterior da mesma fonte (ver delta.go)
+CREATE TABLE IF NOT EXISTS relatorios_delta (
+    documento_id          INTEGER PRIMARY KEY REFERENCES veiculos_xml (id) ON DELETE CASCADE,
+    documento_anterior_id INTEGER REFERENCES veiculos_xml (id) ON DELETE SET NULL,
+    fonte                 TEXT NOT NULL,
+    request_id            TEXT NOT NULL,
+    adicionados           INTEGER NOT NULL,
+    removidos             INTEGER NOT NULL,
+    alterados             INTEGER NOT NULL,
+    delta                 JSONB NOT NULL,
+    xml_delta             XML NOT NULL,
+    data_criacao          TIMESTAMPTZ NOT NULL DEFAULT now()
+);
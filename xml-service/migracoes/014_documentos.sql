@@ -0,0 +1,19 @@
+-- Metadados para a API de documentos: o pedido que gerou cada documento e o hash do XML (ETag)
+ALTER TABLE veiculos_xml ADD COLUMN IF NOT EXISTS request_id TEXT;
+ALTER TABLE veiculos_xml ADD COLUMN IF NOT EXISTS xml_sha256 TEXT;
+
+-- Documentos antigos: pelo job que os guardou ou, se o job já aponta para outro documento
+-- (upload repetido com force=true), pelo Requisitante do próprio XML
+UPDATE veiculos_xml d SET request_id = j.request_id
+FROM jobs j
+WHERE j.documento_id = d.id AND d.request_id IS NULL;
+
+UPDATE veiculos_xml
+SET request_id = substring((xpath('/RelatorioVeiculos/Configuracao/@Requisitante', xml_documento))[1]::text FROM '^Processador_ID_(.*)$')
+WHERE request_id IS NULL;
+
+UPDATE veiculos_xml
+SET xml_sha256 = encode(sha256(convert_to(xml_documento::text, 'UTF8')), 'hex')
+WHERE xml_sha256 IS NULL;
+
+CREATE INDEX IF NOT EXISTS veiculos_xml_request_idx ON veiculos_xml (request_id);
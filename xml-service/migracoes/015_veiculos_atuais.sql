@@ -0,0 +1,15 @@
+-- Observação atual de cada IDInterno em cada política (POLITICA_VEICULOS), mantida no SaveXML.
+-- As estatísticas leem uma linha por veículo daqui em vez de escolherem entre todas as observações.
+CREATE TABLE IF NOT EXISTS veiculos_atuais (
+    politica       TEXT NOT NULL,
+    id_interno     TEXT NOT NULL,
+    veiculo_id     BIGINT NOT NULL REFERENCES veiculos (id) ON DELETE CASCADE,
+    -- Chave da escolha, copiada da observação para comparar com a de cada documento novo
+    confianca      INTEGER NOT NULL,
+    data_documento TIMESTAMPTZ NOT NULL,
+    documento_id   INTEGER NOT NULL,
+    posicao        INTEGER NOT NULL,
+    PRIMARY KEY (politica, id_interno)
+);
+
+CREATE INDEX IF NOT EXISTS veiculos_atuais_veiculo_idx ON veiculos_atuais (veiculo_id);
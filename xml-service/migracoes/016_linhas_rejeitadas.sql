@@ -0,0 +1,10 @@
+-- Linhas que a validação tirou de cada documento (upload ACEITE_PARCIAL). Um veículo rejeitado não
+-- está no Stock mas não saiu do stock da fonte, por isso não fecha o anúncio nem conta como removido.
+ALTER TABLE veiculos_xml ADD COLUMN IF NOT EXISTS ids_rejeitados TEXT[] NOT NULL DEFAULT '{}';
+-- Linhas rejeitadas cujo IDInterno não se conhece: qualquer veículo em falta pode ser uma delas
+ALTER TABLE veiculos_xml ADD COLUMN IF NOT EXISTS rejeitadas_sem_id INTEGER NOT NULL DEFAULT 0;
+
+-- Documentos antigos: só se sabe quantas linhas o job rejeitou, não quais
+UPDATE veiculos_xml d SET rejeitadas_sem_id = j.linhas_rejeitadas
+FROM jobs j
+WHERE j.documento_id = d.id AND j.linhas_rejeitadas > 0;
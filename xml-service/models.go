@@ -2,12 +2,51 @@ package main
 
 import "encoding/xml"
 
+// Versões do payload enviado ao webhook. A versão 1 só tem requestId, status e fileName;
+// a versão 2 acrescenta campos novos sem mudar os antigos.
+const (
+    WebhookPayloadV1 = 1
+    WebhookPayloadV2 = 2
+)
+
 type WebhookResponse struct {
+    VersaoPayload int    `json:"versaoPayload,omitempty"`
+    RequestId     string `json:"requestId"`
+    Status        string `json:"status"`
+    FileName      string `json:"fileName"`
+
+    // Campos da versão 2
+    MapperVersion    string           `json:"mapper,omitempty"`
+    VersaoXSD        string           `json:"versaoXsd,omitempty"` // Versão do XSD do documento gerado
+    LinhasLidas      int              `json:"linhasLidas"`
+    LinhasAceites    int              `json:"linhasAceites"`
+    LinhasRejeitadas int              `json:"linhasRejeitadas"`
+    DocumentoId      int64            `json:"documentoId,omitempty"` // Id em veiculos_xml, se foi guardado
+    ErrosXSD         []ErroDocumento  `json:"errosXsd,omitempty"`
+    ErrosSchematron  []ErroDocumento  `json:"errosSchematron,omitempty"`
+    DuracoesMs       map[string]int64 `json:"duracoesMs,omitempty"`  // Duração de cada etapa do pipeline
+    Delta            *ResumoDelta     `json:"delta,omitempty"`       // Diferenças para o upload anterior (GET /documentos/{id}/delta)
+
+    // Resultado da validação linha a linha (ausente quando o CSV nem chegou a ser lido)
+    Resultado string              `json:"resultado,omitempty"`
+    Validacao *RelatorioValidacao `json:"validacao,omitempty"`
+}
+
+// WebhookResponseV1 é o payload original, para consumidores que pedem webhookVersao=1
+type WebhookResponseV1 struct {
     RequestId string `json:"requestId"`
     Status    string `json:"status"`
     FileName  string `json:"fileName"`
 }
 
+// Resposta do /upload: o job que trata (ou já tratou) o ficheiro
+type RespostaUpload struct {
+    RequestId string `json:"requestId"`
+    Estado    string `json:"estado"`
+    Status    string `json:"status,omitempty"`
+    Repetido  bool   `json:"repetido"`
+}
+
 
 type ListaVeiculos struct {
 	XMLName      xml.Name `xml:"RelatorioVeiculos"`
@@ -29,7 +68,7 @@ type VeiculoXML struct {
 	
 	Identificacao struct {
 		Designacao       string  `xml:"Designacao"`
-		Preco            float64 `xml:"Preco"`
+		Preco            numeroXML `xml:"Preco"`
 		Ano              int     `xml:"Ano"`
 		CategoriaVeiculo string  `xml:"Categoria"`
 	} `xml:"Identificacao"`
@@ -48,8 +87,20 @@ type VeiculoXML struct {
 	Geografia struct {
 		Cidade string `xml:"Cidade"`
 		GPS    struct {
-			Lat float64 `xml:"Lat,attr"`
-			Lon float64 `xml:"Lon,attr"`
+			Lat numeroXML `xml:"Lat,attr"`
+			Lon numeroXML `xml:"Lon,attr"`
 		} `xml:"PosicionamentoGPS"`
 	} `xml:"Geografia"`
-}
\ No newline at end of file
+}
+
+// numeroXML é escrito sem notação científica: o encoding/xml escreve um float64 de 1000000 ou mais
+// como 1e+06, que não é xs:decimal e faria o XSD rejeitar o documento inteiro
+type numeroXML float64
+
+func (n numeroXML) MarshalXML(e *xml.Encoder, inicio xml.StartElement) error {
+	return e.EncodeElement(formatarNumero(float64(n)), inicio)
+}
+
+func (n numeroXML) MarshalXMLAttr(nome xml.Name) (xml.Attr, error) {
+	return xml.Attr{Name: nome, Value: formatarNumero(float64(n))}, nil
+}
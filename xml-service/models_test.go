@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+// Um float64 de 1000000 ou mais sai em notação científica no encoding/xml, que não é xs:decimal
+func TestVeiculoXMLSemNotacaoCientifica(t *testing.T) {
+	esquemas, err := CarregarEsquemas("schemas", "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := VeiculoXML{Identificador: "LUXO-1"}
+	v.Identificacao.Designacao = "Ferrari SF90"
+	v.Identificacao.Preco = 1500000
+	v.Identificacao.Ano = 2023
+	v.Identificacao.CategoriaVeiculo = "Desportivo"
+	v.DetalhesTecnicos.Cilindrada = 3990
+	v.DetalhesTecnicos.PotenciaMotor = 1000
+	v.DetalhesTecnicos.TipoCombustivel = "Híbrido"
+	v.DetalhesTecnicos.TipoTransmissao = "Automática"
+	v.HistoricoUso.Kilometragem = 1200
+	v.Geografia.Cidade = "Lisboa"
+	v.Geografia.GPS.Lat = 38.7223
+	v.Geografia.GPS.Lon = -9.1393
+
+	relatorio := ListaVeiculos{DataGeracao: "2026-10-17", Versao: "1.0", Stock: []VeiculoXML{v}}
+	relatorio.Configuracao.ValidadoPor = "XML_Service_ID_teste"
+	relatorio.Configuracao.Requisitante = "Processador_ID_teste"
+	xmlBytes, err := xml.MarshalIndent(relatorio, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	xmlFinal := xml.Header + string(xmlBytes)
+
+	for _, esperado := range []string{`<Preco>1500000</Preco>`, `Lat="38.7223"`, `Lon="-9.1393"`} {
+		if !strings.Contains(xmlFinal, esperado) {
+			t.Errorf("XML sem %s:\n%s", esperado, xmlFinal)
+		}
+	}
+	if ok, msg, erros := validarComXSD(esquemas, xmlFinal); !ok {
+		t.Errorf("rejeitado pelo XSD: %s %+v", msg, erros)
+	}
+	if ok, msg, erros := validarComSchematron(esquemas, xmlFinal); !ok {
+		t.Errorf("rejeitado pelo Schematron: %s %+v", msg, erros)
+	}
+
+	// O delta volta a ler os documentos guardados
+	lido := ListaVeiculos{}
+	if err := xml.Unmarshal(xmlBytes, &lido); err != nil {
+		t.Fatal(err)
+	}
+	if len(lido.Stock) != 1 || lido.Stock[0].Identificacao.Preco != 1500000 || lido.Stock[0].Geografia.GPS.Lon != -9.1393 {
+		t.Errorf("XML lido: %+v", lido.Stock)
+	}
+}
@@ -24,6 +24,7 @@ const (
 type Filtro struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Termo         string                 `protobuf:"bytes,1,opt,name=termo,proto3" json:"termo,omitempty"`
+	ApenasAtivos  bool                   `protobuf:"varint,2,opt,name=apenas_ativos,json=apenasAtivos,proto3" json:"apenas_ativos,omitempty"` // Estatísticas só sobre o stock ativo (veículos com anúncio aberto)
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -65,6 +66,13 @@ func (x *Filtro) GetTermo() string {
 	return ""
 }
 
+func (x *Filtro) GetApenasAtivos() bool {
+	if x != nil {
+		return x.ApenasAtivos
+	}
+	return false
+}
+
 type Resultado struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Valor         float32                `protobuf:"fixed32,1,opt,name=valor,proto3" json:"valor,omitempty"`
@@ -221,13 +229,490 @@ func (x *LocalizacaoStats) GetValorTotal() float32 {
 	return 0
 }
 
+type EstadoJob struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	RequestId        string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	FileName         string                 `protobuf:"bytes,2,opt,name=file_name,json=fileName,proto3" json:"file_name,omitempty"`
+	Mapper           string                 `protobuf:"bytes,3,opt,name=mapper,proto3" json:"mapper,omitempty"`
+	Estado           string                 `protobuf:"bytes,4,opt,name=estado,proto3" json:"estado,omitempty"`       // queued, parsing, validating, persisted, failed
+	Status           string                 `protobuf:"bytes,5,opt,name=status,proto3" json:"status,omitempty"`       // Status final enviado ao webhook
+	Resultado        string                 `protobuf:"bytes,6,opt,name=resultado,proto3" json:"resultado,omitempty"` // ACEITE, ACEITE_PARCIAL ou REJEITADO
+	LinhasLidas      int32                  `protobuf:"varint,7,opt,name=linhas_lidas,json=linhasLidas,proto3" json:"linhas_lidas,omitempty"`
+	LinhasAceites    int32                  `protobuf:"varint,8,opt,name=linhas_aceites,json=linhasAceites,proto3" json:"linhas_aceites,omitempty"`
+	LinhasRejeitadas int32                  `protobuf:"varint,9,opt,name=linhas_rejeitadas,json=linhasRejeitadas,proto3" json:"linhas_rejeitadas,omitempty"`
+	DataCriacao      string                 `protobuf:"bytes,10,opt,name=data_criacao,json=dataCriacao,proto3" json:"data_criacao,omitempty"`
+	DataAtualizacao  string                 `protobuf:"bytes,11,opt,name=data_atualizacao,json=dataAtualizacao,proto3" json:"data_atualizacao,omitempty"`
+	DataConclusao    string                 `protobuf:"bytes,12,opt,name=data_conclusao,json=dataConclusao,proto3" json:"data_conclusao,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *EstadoJob) Reset() {
+	*x = EstadoJob{}
+	mi := &file_comunicacao_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EstadoJob) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EstadoJob) ProtoMessage() {}
+
+func (x *EstadoJob) ProtoReflect() protoreflect.Message {
+	mi := &file_comunicacao_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EstadoJob.ProtoReflect.Descriptor instead.
+func (*EstadoJob) Descriptor() ([]byte, []int) {
+	return file_comunicacao_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *EstadoJob) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *EstadoJob) GetFileName() string {
+	if x != nil {
+		return x.FileName
+	}
+	return ""
+}
+
+func (x *EstadoJob) GetMapper() string {
+	if x != nil {
+		return x.Mapper
+	}
+	return ""
+}
+
+func (x *EstadoJob) GetEstado() string {
+	if x != nil {
+		return x.Estado
+	}
+	return ""
+}
+
+func (x *EstadoJob) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *EstadoJob) GetResultado() string {
+	if x != nil {
+		return x.Resultado
+	}
+	return ""
+}
+
+func (x *EstadoJob) GetLinhasLidas() int32 {
+	if x != nil {
+		return x.LinhasLidas
+	}
+	return 0
+}
+
+func (x *EstadoJob) GetLinhasAceites() int32 {
+	if x != nil {
+		return x.LinhasAceites
+	}
+	return 0
+}
+
+func (x *EstadoJob) GetLinhasRejeitadas() int32 {
+	if x != nil {
+		return x.LinhasRejeitadas
+	}
+	return 0
+}
+
+func (x *EstadoJob) GetDataCriacao() string {
+	if x != nil {
+		return x.DataCriacao
+	}
+	return ""
+}
+
+func (x *EstadoJob) GetDataAtualizacao() string {
+	if x != nil {
+		return x.DataAtualizacao
+	}
+	return ""
+}
+
+func (x *EstadoJob) GetDataConclusao() string {
+	if x != nil {
+		return x.DataConclusao
+	}
+	return ""
+}
+
+type VeiculoHistorico struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	IdInterno         string                 `protobuf:"bytes,1,opt,name=id_interno,json=idInterno,proto3" json:"id_interno,omitempty"`
+	Designacao        string                 `protobuf:"bytes,2,opt,name=designacao,proto3" json:"designacao,omitempty"`
+	PrimeiroDocumento int64                  `protobuf:"varint,3,opt,name=primeiro_documento,json=primeiroDocumento,proto3" json:"primeiro_documento,omitempty"`
+	PrimeiraVez       string                 `protobuf:"bytes,4,opt,name=primeira_vez,json=primeiraVez,proto3" json:"primeira_vez,omitempty"`
+	UltimoDocumento   int64                  `protobuf:"varint,5,opt,name=ultimo_documento,json=ultimoDocumento,proto3" json:"ultimo_documento,omitempty"`
+	UltimaVez         string                 `protobuf:"bytes,6,opt,name=ultima_vez,json=ultimaVez,proto3" json:"ultima_vez,omitempty"`
+	Observacoes       int32                  `protobuf:"varint,7,opt,name=observacoes,proto3" json:"observacoes,omitempty"`                 // Número de uploads em que o veículo apareceu
+	Alteracoes        []*AlteracaoVeiculo    `protobuf:"bytes,8,rep,name=alteracoes,proto3" json:"alteracoes,omitempty"`                    // A primeira observação e cada mudança de preço ou kms
+	Estado            string                 `protobuf:"bytes,9,opt,name=estado,proto3" json:"estado,omitempty"`                            // ativo, removido ou reanunciado
+	DataEstado        string                 `protobuf:"bytes,10,opt,name=data_estado,json=dataEstado,proto3" json:"data_estado,omitempty"` // Quando o veículo passou ao estado atual
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *VeiculoHistorico) Reset() {
+	*x = VeiculoHistorico{}
+	mi := &file_comunicacao_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VeiculoHistorico) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VeiculoHistorico) ProtoMessage() {}
+
+func (x *VeiculoHistorico) ProtoReflect() protoreflect.Message {
+	mi := &file_comunicacao_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VeiculoHistorico.ProtoReflect.Descriptor instead.
+func (*VeiculoHistorico) Descriptor() ([]byte, []int) {
+	return file_comunicacao_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *VeiculoHistorico) GetIdInterno() string {
+	if x != nil {
+		return x.IdInterno
+	}
+	return ""
+}
+
+func (x *VeiculoHistorico) GetDesignacao() string {
+	if x != nil {
+		return x.Designacao
+	}
+	return ""
+}
+
+func (x *VeiculoHistorico) GetPrimeiroDocumento() int64 {
+	if x != nil {
+		return x.PrimeiroDocumento
+	}
+	return 0
+}
+
+func (x *VeiculoHistorico) GetPrimeiraVez() string {
+	if x != nil {
+		return x.PrimeiraVez
+	}
+	return ""
+}
+
+func (x *VeiculoHistorico) GetUltimoDocumento() int64 {
+	if x != nil {
+		return x.UltimoDocumento
+	}
+	return 0
+}
+
+func (x *VeiculoHistorico) GetUltimaVez() string {
+	if x != nil {
+		return x.UltimaVez
+	}
+	return ""
+}
+
+func (x *VeiculoHistorico) GetObservacoes() int32 {
+	if x != nil {
+		return x.Observacoes
+	}
+	return 0
+}
+
+func (x *VeiculoHistorico) GetAlteracoes() []*AlteracaoVeiculo {
+	if x != nil {
+		return x.Alteracoes
+	}
+	return nil
+}
+
+func (x *VeiculoHistorico) GetEstado() string {
+	if x != nil {
+		return x.Estado
+	}
+	return ""
+}
+
+func (x *VeiculoHistorico) GetDataEstado() string {
+	if x != nil {
+		return x.DataEstado
+	}
+	return ""
+}
+
+type AlteracaoVeiculo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DocumentoId   int64                  `protobuf:"varint,1,opt,name=documento_id,json=documentoId,proto3" json:"documento_id,omitempty"`
+	Data          string                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	Preco         float32                `protobuf:"fixed32,3,opt,name=preco,proto3" json:"preco,omitempty"`
+	Kms           float32                `protobuf:"fixed32,4,opt,name=kms,proto3" json:"kms,omitempty"`
+	PrecoAnterior float32                `protobuf:"fixed32,5,opt,name=preco_anterior,json=precoAnterior,proto3" json:"preco_anterior,omitempty"`
+	KmsAnterior   float32                `protobuf:"fixed32,6,opt,name=kms_anterior,json=kmsAnterior,proto3" json:"kms_anterior,omitempty"`
+	Primeira      bool                   `protobuf:"varint,7,opt,name=primeira,proto3" json:"primeira,omitempty"` // Primeira vez que o veículo foi visto (sem valores anteriores)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AlteracaoVeiculo) Reset() {
+	*x = AlteracaoVeiculo{}
+	mi := &file_comunicacao_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AlteracaoVeiculo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AlteracaoVeiculo) ProtoMessage() {}
+
+func (x *AlteracaoVeiculo) ProtoReflect() protoreflect.Message {
+	mi := &file_comunicacao_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AlteracaoVeiculo.ProtoReflect.Descriptor instead.
+func (*AlteracaoVeiculo) Descriptor() ([]byte, []int) {
+	return file_comunicacao_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *AlteracaoVeiculo) GetDocumentoId() int64 {
+	if x != nil {
+		return x.DocumentoId
+	}
+	return 0
+}
+
+func (x *AlteracaoVeiculo) GetData() string {
+	if x != nil {
+		return x.Data
+	}
+	return ""
+}
+
+func (x *AlteracaoVeiculo) GetPreco() float32 {
+	if x != nil {
+		return x.Preco
+	}
+	return 0
+}
+
+func (x *AlteracaoVeiculo) GetKms() float32 {
+	if x != nil {
+		return x.Kms
+	}
+	return 0
+}
+
+func (x *AlteracaoVeiculo) GetPrecoAnterior() float32 {
+	if x != nil {
+		return x.PrecoAnterior
+	}
+	return 0
+}
+
+func (x *AlteracaoVeiculo) GetKmsAnterior() float32 {
+	if x != nil {
+		return x.KmsAnterior
+	}
+	return 0
+}
+
+func (x *AlteracaoVeiculo) GetPrimeira() bool {
+	if x != nil {
+		return x.Primeira
+	}
+	return false
+}
+
+type DiasNoMercado struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Agrupamento   string                 `protobuf:"bytes,1,opt,name=agrupamento,proto3" json:"agrupamento,omitempty"` // marca ou segmento
+	Grupos        []*DiasNoMercadoGrupo  `protobuf:"bytes,2,rep,name=grupos,proto3" json:"grupos,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DiasNoMercado) Reset() {
+	*x = DiasNoMercado{}
+	mi := &file_comunicacao_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DiasNoMercado) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DiasNoMercado) ProtoMessage() {}
+
+func (x *DiasNoMercado) ProtoReflect() protoreflect.Message {
+	mi := &file_comunicacao_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DiasNoMercado.ProtoReflect.Descriptor instead.
+func (*DiasNoMercado) Descriptor() ([]byte, []int) {
+	return file_comunicacao_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DiasNoMercado) GetAgrupamento() string {
+	if x != nil {
+		return x.Agrupamento
+	}
+	return ""
+}
+
+func (x *DiasNoMercado) GetGrupos() []*DiasNoMercadoGrupo {
+	if x != nil {
+		return x.Grupos
+	}
+	return nil
+}
+
+type DiasNoMercadoGrupo struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Grupo              string                 `protobuf:"bytes,1,opt,name=grupo,proto3" json:"grupo,omitempty"`
+	Anuncios           int32                  `protobuf:"varint,2,opt,name=anuncios,proto3" json:"anuncios,omitempty"`
+	Ativos             int32                  `protobuf:"varint,3,opt,name=ativos,proto3" json:"ativos,omitempty"`
+	Removidos          int32                  `protobuf:"varint,4,opt,name=removidos,proto3" json:"removidos,omitempty"`
+	MediaDias          float32                `protobuf:"fixed32,5,opt,name=media_dias,json=mediaDias,proto3" json:"media_dias,omitempty"`                              // Os anúncios ativos contam até agora
+	MediaDiasRemovidos float32                `protobuf:"fixed32,6,opt,name=media_dias_removidos,json=mediaDiasRemovidos,proto3" json:"media_dias_removidos,omitempty"` // Só os anúncios já fechados
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *DiasNoMercadoGrupo) Reset() {
+	*x = DiasNoMercadoGrupo{}
+	mi := &file_comunicacao_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DiasNoMercadoGrupo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DiasNoMercadoGrupo) ProtoMessage() {}
+
+func (x *DiasNoMercadoGrupo) ProtoReflect() protoreflect.Message {
+	mi := &file_comunicacao_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DiasNoMercadoGrupo.ProtoReflect.Descriptor instead.
+func (*DiasNoMercadoGrupo) Descriptor() ([]byte, []int) {
+	return file_comunicacao_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DiasNoMercadoGrupo) GetGrupo() string {
+	if x != nil {
+		return x.Grupo
+	}
+	return ""
+}
+
+func (x *DiasNoMercadoGrupo) GetAnuncios() int32 {
+	if x != nil {
+		return x.Anuncios
+	}
+	return 0
+}
+
+func (x *DiasNoMercadoGrupo) GetAtivos() int32 {
+	if x != nil {
+		return x.Ativos
+	}
+	return 0
+}
+
+func (x *DiasNoMercadoGrupo) GetRemovidos() int32 {
+	if x != nil {
+		return x.Removidos
+	}
+	return 0
+}
+
+func (x *DiasNoMercadoGrupo) GetMediaDias() float32 {
+	if x != nil {
+		return x.MediaDias
+	}
+	return 0
+}
+
+func (x *DiasNoMercadoGrupo) GetMediaDiasRemovidos() float32 {
+	if x != nil {
+		return x.MediaDiasRemovidos
+	}
+	return 0
+}
+
 var File_comunicacao_proto protoreflect.FileDescriptor
 
 const file_comunicacao_proto_rawDesc = "" +
 	"\n" +
-	"\x11comunicacao.proto\x12\vcomunicacao\"\x1e\n" +
+	"\x11comunicacao.proto\x12\vcomunicacao\"C\n" +
 	"\x06Filtro\x12\x14\n" +
-	"\x05termo\x18\x01 \x01(\tR\x05termo\"!\n" +
+	"\x05termo\x18\x01 \x01(\tR\x05termo\x12#\n" +
+	"\rapenas_ativos\x18\x02 \x01(\bR\fapenasAtivos\"!\n" +
 	"\tResultado\x12\x14\n" +
 	"\x05valor\x18\x01 \x01(\x02R\x05valor\"`\n" +
 	"\n" +
@@ -239,11 +724,67 @@ const file_comunicacao_proto_rawDesc = "" +
 	"\x10LocalizacaoStats\x12!\n" +
 	"\ftotal_carros\x18\x01 \x01(\x05R\vtotalCarros\x12\x1f\n" +
 	"\vvalor_total\x18\x02 \x01(\x02R\n" +
-	"valorTotal2\xde\x01\n" +
+	"valorTotal\"\x99\x03\n" +
+	"\tEstadoJob\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12\x1b\n" +
+	"\tfile_name\x18\x02 \x01(\tR\bfileName\x12\x16\n" +
+	"\x06mapper\x18\x03 \x01(\tR\x06mapper\x12\x16\n" +
+	"\x06estado\x18\x04 \x01(\tR\x06estado\x12\x16\n" +
+	"\x06status\x18\x05 \x01(\tR\x06status\x12\x1c\n" +
+	"\tresultado\x18\x06 \x01(\tR\tresultado\x12!\n" +
+	"\flinhas_lidas\x18\a \x01(\x05R\vlinhasLidas\x12%\n" +
+	"\x0elinhas_aceites\x18\b \x01(\x05R\rlinhasAceites\x12+\n" +
+	"\x11linhas_rejeitadas\x18\t \x01(\x05R\x10linhasRejeitadas\x12!\n" +
+	"\fdata_criacao\x18\n" +
+	" \x01(\tR\vdataCriacao\x12)\n" +
+	"\x10data_atualizacao\x18\v \x01(\tR\x0fdataAtualizacao\x12%\n" +
+	"\x0edata_conclusao\x18\f \x01(\tR\rdataConclusao\"\x87\x03\n" +
+	"\x10VeiculoHistorico\x12\x1d\n" +
+	"\n" +
+	"id_interno\x18\x01 \x01(\tR\tidInterno\x12\x1e\n" +
+	"\n" +
+	"designacao\x18\x02 \x01(\tR\n" +
+	"designacao\x12-\n" +
+	"\x12primeiro_documento\x18\x03 \x01(\x03R\x11primeiroDocumento\x12!\n" +
+	"\fprimeira_vez\x18\x04 \x01(\tR\vprimeiraVez\x12)\n" +
+	"\x10ultimo_documento\x18\x05 \x01(\x03R\x0fultimoDocumento\x12\x1d\n" +
+	"\n" +
+	"ultima_vez\x18\x06 \x01(\tR\tultimaVez\x12 \n" +
+	"\vobservacoes\x18\a \x01(\x05R\vobservacoes\x12=\n" +
+	"\n" +
+	"alteracoes\x18\b \x03(\v2\x1d.comunicacao.AlteracaoVeiculoR\n" +
+	"alteracoes\x12\x16\n" +
+	"\x06estado\x18\t \x01(\tR\x06estado\x12\x1f\n" +
+	"\vdata_estado\x18\n" +
+	" \x01(\tR\n" +
+	"dataEstado\"\xd7\x01\n" +
+	"\x10AlteracaoVeiculo\x12!\n" +
+	"\fdocumento_id\x18\x01 \x01(\x03R\vdocumentoId\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\tR\x04data\x12\x14\n" +
+	"\x05preco\x18\x03 \x01(\x02R\x05preco\x12\x10\n" +
+	"\x03kms\x18\x04 \x01(\x02R\x03kms\x12%\n" +
+	"\x0epreco_anterior\x18\x05 \x01(\x02R\rprecoAnterior\x12!\n" +
+	"\fkms_anterior\x18\x06 \x01(\x02R\vkmsAnterior\x12\x1a\n" +
+	"\bprimeira\x18\a \x01(\bR\bprimeira\"j\n" +
+	"\rDiasNoMercado\x12 \n" +
+	"\vagrupamento\x18\x01 \x01(\tR\vagrupamento\x127\n" +
+	"\x06grupos\x18\x02 \x03(\v2\x1f.comunicacao.DiasNoMercadoGrupoR\x06grupos\"\xcd\x01\n" +
+	"\x12DiasNoMercadoGrupo\x12\x14\n" +
+	"\x05grupo\x18\x01 \x01(\tR\x05grupo\x12\x1a\n" +
+	"\banuncios\x18\x02 \x01(\x05R\banuncios\x12\x16\n" +
+	"\x06ativos\x18\x03 \x01(\x05R\x06ativos\x12\x1c\n" +
+	"\tremovidos\x18\x04 \x01(\x05R\tremovidos\x12\x1d\n" +
+	"\n" +
+	"media_dias\x18\x05 \x01(\x02R\tmediaDias\x120\n" +
+	"\x14media_dias_removidos\x18\x06 \x01(\x02R\x12mediaDiasRemovidos2\xab\x03\n" +
 	"\x0eBIQueryService\x12=\n" +
 	"\rGetMarcaStats\x12\x13.comunicacao.Filtro\x1a\x17.comunicacao.MarcaStats\x12B\n" +
 	"\x13GetContagemSegmento\x12\x13.comunicacao.Filtro\x1a\x16.comunicacao.Resultado\x12I\n" +
-	"\x13GetLocalizacaoStats\x12\x13.comunicacao.Filtro\x1a\x1d.comunicacao.LocalizacaoStatsB\x06Z\x04./pbb\x06proto3"
+	"\x13GetLocalizacaoStats\x12\x13.comunicacao.Filtro\x1a\x1d.comunicacao.LocalizacaoStats\x12;\n" +
+	"\fGetEstadoJob\x12\x13.comunicacao.Filtro\x1a\x16.comunicacao.EstadoJob\x12I\n" +
+	"\x13GetVeiculoHistorico\x12\x13.comunicacao.Filtro\x1a\x1d.comunicacao.VeiculoHistorico\x12C\n" +
+	"\x10GetDiasNoMercado\x12\x13.comunicacao.Filtro\x1a\x1a.comunicacao.DiasNoMercadoB\x06Z\x04./pbb\x06proto3"
 
 var (
 	file_comunicacao_proto_rawDescOnce sync.Once
@@ -257,25 +798,38 @@ func file_comunicacao_proto_rawDescGZIP() []byte {
 	return file_comunicacao_proto_rawDescData
 }
 
-var file_comunicacao_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_comunicacao_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
 var file_comunicacao_proto_goTypes = []any{
-	(*Filtro)(nil),           // 0: comunicacao.Filtro
-	(*Resultado)(nil),        // 1: comunicacao.Resultado
-	(*MarcaStats)(nil),       // 2: comunicacao.MarcaStats
-	(*LocalizacaoStats)(nil), // 3: comunicacao.LocalizacaoStats
+	(*Filtro)(nil),             // 0: comunicacao.Filtro
+	(*Resultado)(nil),          // 1: comunicacao.Resultado
+	(*MarcaStats)(nil),         // 2: comunicacao.MarcaStats
+	(*LocalizacaoStats)(nil),   // 3: comunicacao.LocalizacaoStats
+	(*EstadoJob)(nil),          // 4: comunicacao.EstadoJob
+	(*VeiculoHistorico)(nil),   // 5: comunicacao.VeiculoHistorico
+	(*AlteracaoVeiculo)(nil),   // 6: comunicacao.AlteracaoVeiculo
+	(*DiasNoMercado)(nil),      // 7: comunicacao.DiasNoMercado
+	(*DiasNoMercadoGrupo)(nil), // 8: comunicacao.DiasNoMercadoGrupo
 }
 var file_comunicacao_proto_depIdxs = []int32{
-	0, // 0: comunicacao.BIQueryService.GetMarcaStats:input_type -> comunicacao.Filtro
-	0, // 1: comunicacao.BIQueryService.GetContagemSegmento:input_type -> comunicacao.Filtro
-	0, // 2: comunicacao.BIQueryService.GetLocalizacaoStats:input_type -> comunicacao.Filtro
-	2, // 3: comunicacao.BIQueryService.GetMarcaStats:output_type -> comunicacao.MarcaStats
-	1, // 4: comunicacao.BIQueryService.GetContagemSegmento:output_type -> comunicacao.Resultado
-	3, // 5: comunicacao.BIQueryService.GetLocalizacaoStats:output_type -> comunicacao.LocalizacaoStats
-	3, // [3:6] is the sub-list for method output_type
-	0, // [0:3] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	6, // 0: comunicacao.VeiculoHistorico.alteracoes:type_name -> comunicacao.AlteracaoVeiculo
+	8, // 1: comunicacao.DiasNoMercado.grupos:type_name -> comunicacao.DiasNoMercadoGrupo
+	0, // 2: comunicacao.BIQueryService.GetMarcaStats:input_type -> comunicacao.Filtro
+	0, // 3: comunicacao.BIQueryService.GetContagemSegmento:input_type -> comunicacao.Filtro
+	0, // 4: comunicacao.BIQueryService.GetLocalizacaoStats:input_type -> comunicacao.Filtro
+	0, // 5: comunicacao.BIQueryService.GetEstadoJob:input_type -> comunicacao.Filtro
+	0, // 6: comunicacao.BIQueryService.GetVeiculoHistorico:input_type -> comunicacao.Filtro
+	0, // 7: comunicacao.BIQueryService.GetDiasNoMercado:input_type -> comunicacao.Filtro
+	2, // 8: comunicacao.BIQueryService.GetMarcaStats:output_type -> comunicacao.MarcaStats
+	1, // 9: comunicacao.BIQueryService.GetContagemSegmento:output_type -> comunicacao.Resultado
+	3, // 10: comunicacao.BIQueryService.GetLocalizacaoStats:output_type -> comunicacao.LocalizacaoStats
+	4, // 11: comunicacao.BIQueryService.GetEstadoJob:output_type -> comunicacao.EstadoJob
+	5, // 12: comunicacao.BIQueryService.GetVeiculoHistorico:output_type -> comunicacao.VeiculoHistorico
+	7, // 13: comunicacao.BIQueryService.GetDiasNoMercado:output_type -> comunicacao.DiasNoMercado
+	8, // [8:14] is the sub-list for method output_type
+	2, // [2:8] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
 }
 
 func init() { file_comunicacao_proto_init() }
@@ -289,7 +843,7 @@ func file_comunicacao_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_comunicacao_proto_rawDesc), len(file_comunicacao_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   4,
+			NumMessages:   9,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
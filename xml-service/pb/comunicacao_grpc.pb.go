@@ -22,6 +22,9 @@ const (
 	BIQueryService_GetMarcaStats_FullMethodName       = "/comunicacao.BIQueryService/GetMarcaStats"
 	BIQueryService_GetContagemSegmento_FullMethodName = "/comunicacao.BIQueryService/GetContagemSegmento"
 	BIQueryService_GetLocalizacaoStats_FullMethodName = "/comunicacao.BIQueryService/GetLocalizacaoStats"
+	BIQueryService_GetEstadoJob_FullMethodName        = "/comunicacao.BIQueryService/GetEstadoJob"
+	BIQueryService_GetVeiculoHistorico_FullMethodName = "/comunicacao.BIQueryService/GetVeiculoHistorico"
+	BIQueryService_GetDiasNoMercado_FullMethodName    = "/comunicacao.BIQueryService/GetDiasNoMercado"
 )
 
 // BIQueryServiceClient is the client API for BIQueryService service.
@@ -31,6 +34,9 @@ type BIQueryServiceClient interface {
 	GetMarcaStats(ctx context.Context, in *Filtro, opts ...grpc.CallOption) (*MarcaStats, error)
 	GetContagemSegmento(ctx context.Context, in *Filtro, opts ...grpc.CallOption) (*Resultado, error)
 	GetLocalizacaoStats(ctx context.Context, in *Filtro, opts ...grpc.CallOption) (*LocalizacaoStats, error)
+	GetEstadoJob(ctx context.Context, in *Filtro, opts ...grpc.CallOption) (*EstadoJob, error)
+	GetVeiculoHistorico(ctx context.Context, in *Filtro, opts ...grpc.CallOption) (*VeiculoHistorico, error)
+	GetDiasNoMercado(ctx context.Context, in *Filtro, opts ...grpc.CallOption) (*DiasNoMercado, error)
 }
 
 type bIQueryServiceClient struct {
@@ -71,6 +77,36 @@ func (c *bIQueryServiceClient) GetLocalizacaoStats(ctx context.Context, in *Filt
 	return out, nil
 }
 
+func (c *bIQueryServiceClient) GetEstadoJob(ctx context.Context, in *Filtro, opts ...grpc.CallOption) (*EstadoJob, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EstadoJob)
+	err := c.cc.Invoke(ctx, BIQueryService_GetEstadoJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bIQueryServiceClient) GetVeiculoHistorico(ctx context.Context, in *Filtro, opts ...grpc.CallOption) (*VeiculoHistorico, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VeiculoHistorico)
+	err := c.cc.Invoke(ctx, BIQueryService_GetVeiculoHistorico_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bIQueryServiceClient) GetDiasNoMercado(ctx context.Context, in *Filtro, opts ...grpc.CallOption) (*DiasNoMercado, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DiasNoMercado)
+	err := c.cc.Invoke(ctx, BIQueryService_GetDiasNoMercado_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // BIQueryServiceServer is the server API for BIQueryService service.
 // All implementations must embed UnimplementedBIQueryServiceServer
 // for forward compatibility.
@@ -78,6 +114,9 @@ type BIQueryServiceServer interface {
 	GetMarcaStats(context.Context, *Filtro) (*MarcaStats, error)
 	GetContagemSegmento(context.Context, *Filtro) (*Resultado, error)
 	GetLocalizacaoStats(context.Context, *Filtro) (*LocalizacaoStats, error)
+	GetEstadoJob(context.Context, *Filtro) (*EstadoJob, error)
+	GetVeiculoHistorico(context.Context, *Filtro) (*VeiculoHistorico, error)
+	GetDiasNoMercado(context.Context, *Filtro) (*DiasNoMercado, error)
 	mustEmbedUnimplementedBIQueryServiceServer()
 }
 
@@ -97,6 +136,15 @@ func (UnimplementedBIQueryServiceServer) GetContagemSegmento(context.Context, *F
 func (UnimplementedBIQueryServiceServer) GetLocalizacaoStats(context.Context, *Filtro) (*LocalizacaoStats, error) {
 	return nil, status.Error(codes.Unimplemented, "method GetLocalizacaoStats not implemented")
 }
+func (UnimplementedBIQueryServiceServer) GetEstadoJob(context.Context, *Filtro) (*EstadoJob, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetEstadoJob not implemented")
+}
+func (UnimplementedBIQueryServiceServer) GetVeiculoHistorico(context.Context, *Filtro) (*VeiculoHistorico, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetVeiculoHistorico not implemented")
+}
+func (UnimplementedBIQueryServiceServer) GetDiasNoMercado(context.Context, *Filtro) (*DiasNoMercado, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetDiasNoMercado not implemented")
+}
 func (UnimplementedBIQueryServiceServer) mustEmbedUnimplementedBIQueryServiceServer() {}
 func (UnimplementedBIQueryServiceServer) testEmbeddedByValue()                        {}
 
@@ -172,6 +220,60 @@ func _BIQueryService_GetLocalizacaoStats_Handler(srv interface{}, ctx context.Co
 	return interceptor(ctx, in, info, handler)
 }
 
+func _BIQueryService_GetEstadoJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Filtro)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BIQueryServiceServer).GetEstadoJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BIQueryService_GetEstadoJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BIQueryServiceServer).GetEstadoJob(ctx, req.(*Filtro))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BIQueryService_GetVeiculoHistorico_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Filtro)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BIQueryServiceServer).GetVeiculoHistorico(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BIQueryService_GetVeiculoHistorico_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BIQueryServiceServer).GetVeiculoHistorico(ctx, req.(*Filtro))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BIQueryService_GetDiasNoMercado_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Filtro)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BIQueryServiceServer).GetDiasNoMercado(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BIQueryService_GetDiasNoMercado_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BIQueryServiceServer).GetDiasNoMercado(ctx, req.(*Filtro))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // BIQueryService_ServiceDesc is the grpc.ServiceDesc for BIQueryService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -191,6 +293,18 @@ var BIQueryService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetLocalizacaoStats",
 			Handler:    _BIQueryService_GetLocalizacaoStats_Handler,
 		},
+		{
+			MethodName: "GetEstadoJob",
+			Handler:    _BIQueryService_GetEstadoJob_Handler,
+		},
+		{
+			MethodName: "GetVeiculoHistorico",
+			Handler:    _BIQueryService_GetVeiculoHistorico_Handler,
+		},
+		{
+			MethodName: "GetDiasNoMercado",
+			Handler:    _BIQueryService_GetDiasNoMercado_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "comunicacao.proto",
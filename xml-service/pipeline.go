@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"log"
+	"time"
+)
+
+// PedidoUpload é um CSV aceite pelo /upload, à espera de ser processado
+type PedidoUpload struct {
+	RequestId     string
+	FileName      string
+	WebhookURL    string
+	MapperVersion string
+	Mapper        *Mapper
+	Esquemas      *RegistoEsquemas
+	EsquemaDelta  *EsquemaXSD
+	Regras        *MotorRegras
+	CSV           []byte
+	CsvSha256     string
+	WebhookVersao int    // Versão do payload do webhook pedida pelo cliente
+	VersaoXSD     string // Versão do formato de saída (RelatorioVeiculos/@Versao)
+	Fonte         string // Origem do stock; os uploads da mesma fonte são comparados entre si
+
+	// Preenchidos pelo worker ao reclamar o pedido da fila
+	Tentativas  int    // Vezes que o pedido foi reclamado, contando com esta
+	EstadoJob   string // Estado do job no momento em que foi reclamado
+	DocumentoId int64  // Documento guardado por uma tentativa anterior que não chegou ao fim
+}
+
+// processarUpload corre o pipeline completo de um pedido:
+// CSV -> VeiculoXML (mapper) -> validação -> XML + XSD -> PostgreSQL -> webhook.
+// O estado do job vai sendo atualizado na tabela jobs em cada etapa.
+func processarUpload(db *sql.DB, p PedidoUpload) {
+	id, fname, wURL := p.RequestId, p.FileName, p.WebhookURL
+	var validacao *RelatorioValidacao
+	var documentoID int64
+	var errosXSD, errosSchematron []ErroDocumento
+	var delta *RelatorioDelta
+
+	// Duração de cada etapa, reportada no webhook
+	inicio := time.Now()
+	ultimaEtapa := inicio
+	duracoes := map[string]int64{}
+	marcar := func(etapa string) {
+		agora := time.Now()
+		duracoes[etapa] = agora.Sub(ultimaEtapa).Milliseconds()
+		ultimaEtapa = agora
+	}
+
+	// Dados usados pelos filtros das subscrições
+	contexto := contextoEvento{RequestId: id, Mapper: p.MapperVersion, FileName: fname}
+
+	// terminar fecha o job com o estado final e avisa o webhook do upload e as subscrições
+	terminar := func(estado string, status string) {
+		duracoes["total"] = time.Since(inicio).Milliseconds()
+		FinishJob(db, id, estado, status, validacao, documentoID)
+
+		evento := EventoJobCompleted
+		if estado == EstadoFailed {
+			evento = EventoJobFailed
+		}
+		data := WebhookResponse{
+			RequestId:       id,
+			Status:          status,
+			FileName:        fname,
+			MapperVersion:   p.MapperVersion,
+			VersaoXSD:       p.VersaoXSD,
+			DocumentoId:     documentoID,
+			ErrosXSD:        errosXSD,
+			ErrosSchematron: errosSchematron,
+			DuracoesMs:      duracoes,
+		}
+		if delta != nil {
+			data.Delta = &delta.Resumo
+		}
+		if validacao != nil {
+			data.LinhasLidas = validacao.LinhasLidas
+			data.LinhasAceites = validacao.LinhasAceites
+			data.LinhasRejeitadas = validacao.LinhasRejeitadas
+			data.Resultado = validacao.Resultado
+			data.Validacao = validacao
+		}
+
+		if wURL != "" {
+			callWebhook(db, wURL, p.WebhookVersao, evento, data)
+		}
+		data.VersaoPayload = WebhookPayloadV2
+		publicarEvento(db, evento, contexto, data)
+	}
+
+	UpdateJobEstado(db, id, EstadoParsing)
+
+	reader := csv.NewReader(bytes.NewReader(p.CSV))
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+
+	cabecalho, err := reader.Read()
+	if err == io.EOF {
+		terminar(EstadoFailed, "ERRO_CSV: ficheiro vazio")
+		return
+	}
+	if err != nil {
+		terminar(EstadoFailed, "ERRO_CSV")
+		return
+	}
+
+	// As colunas são resolvidas pelo nome no cabeçalho, não pela posição
+	colunas, err := mapearCabecalho(p.Mapper.Colunas(), cabecalho)
+	if err != nil {
+		log.Println("CSV rejeitado:", err)
+		terminar(EstadoFailed, "ERRO_CSV_COLUNAS: "+err.Error())
+		return
+	}
+
+	// --- AJUSTE AQUI: Preenchimento conforme o exemplo do professor ---
+	relatorio := ListaVeiculos{
+		DataGeracao: time.Now().Format("2006-01-02"),
+		Versao:      p.VersaoXSD, // Versão do esquema, escolhe o XSD na validação
+		Stock:       []VeiculoXML{},
+	}
+	// Usando o ID dinâmico nos atributos de configuração
+	relatorio.Configuracao.ValidadoPor = "XML_Service_ID_" + id
+	relatorio.Configuracao.Requisitante = "Processador_ID_" + id
+
+	// Validação linha a linha: só entram no XML as linhas sem erros
+	// linhasCSV[i] é a linha do CSV de onde veio relatorio.Stock[i], para situar os erros do XSD
+	validacao = &RelatorioValidacao{}
+	var linhasCSV []int
+	var rejeitados Rejeitados
+	for {
+		col, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			validacao = nil
+			terminar(EstadoFailed, "ERRO_CSV")
+			return
+		}
+		numLinha, _ := reader.FieldPos(0)
+
+		v, erros := p.Mapper.MapearLinha(numLinha, col, colunas)
+		if validacao.registarLinha(erros) {
+			relatorio.Stock = append(relatorio.Stock, v)
+			linhasCSV = append(linhasCSV, numLinha)
+		} else {
+			// O IDInterno só fica preenchido se a própria célula passou na conversão
+			rejeitados.juntar(v.Identificador)
+		}
+	}
+	marcar("parsing")
+	UpdateJobEstado(db, id, EstadoValidating)
+
+	// Regras de negócio por veículo: os erros retiram o veículo do XML, os avisos só ficam no relatório
+	ano := time.Now().Year()
+	vistos := VistosUpload{}
+	aceites, linhasAceites := relatorio.Stock[:0], linhasCSV[:0]
+	for i := range relatorio.Stock {
+		if validacao.registarVeiculo(p.Regras.Avaliar(&relatorio.Stock[i], linhasCSV[i], ano, vistos)) {
+			aceites = append(aceites, relatorio.Stock[i])
+			linhasAceites = append(linhasAceites, linhasCSV[i])
+		} else {
+			rejeitados.juntar(relatorio.Stock[i].Identificador)
+		}
+	}
+	relatorio.Stock, linhasCSV = aceites, linhasAceites
+	validacao.concluir()
+	marcar("validacao")
+	SaveRelatorioValidacao(db, id, fname, validacao)
+
+	if validacao.Resultado == ResultadoRejeitado {
+		status := "ERRO_VALIDACAO"
+		if validacao.LinhasLidas == 0 {
+			status = "ERRO_NEGOCIO: Lista de veículos vazia"
+		}
+		log.Printf("Upload %s rejeitado: %d linhas com erros\n", id, validacao.LinhasRejeitadas)
+		terminar(EstadoFailed, status)
+		return
+	}
+
+	// 2. Gerar o XML
+	xmlBytes, _ := xml.MarshalIndent(relatorio, "", "  ")
+	xmlFinal := string(xml.Header) + string(xmlBytes)
+
+	// 3. Validação XSD (O "Segurança" do contrato)
+	xsdOk, xsdMsg, erros := validarComXSD(p.Esquemas, xmlFinal)
+	marcar("xsd")
+	if !xsdOk {
+		situarErros(erros, linhasCSV)
+		errosXSD = erros
+		validacao.ErrosXSD = erros
+		SaveErrosDocumento(db, id, errosXSD, nil)
+		log.Println("Rejeitado pelo XSD:", xsdMsg)
+		terminar(EstadoFailed, xsdMsg)
+		return
+	}
+
+	// 3b. Schematron (regras entre campos), só se existir um .sch para a versão do documento
+	schOk, schMsg, erros := validarComSchematron(p.Esquemas, xmlFinal)
+	marcar("schematron")
+	if len(erros) > 0 {
+		situarErros(erros, linhasCSV)
+		errosSchematron = erros
+		validacao.ErrosSchematron = erros
+		SaveErrosDocumento(db, id, nil, errosSchematron)
+	}
+	if !schOk {
+		log.Println("Rejeitado pelo Schematron:", schMsg)
+		terminar(EstadoFailed, schMsg)
+		return
+	}
+
+	// 4. Só persiste se passar no XSD. Sem fonte, os uploads do mesmo mapper contam como a mesma origem.
+	fonte := p.Fonte
+	if fonte == "" {
+		fonte = p.MapperVersion
+	}
+	// Uma tentativa anterior que caiu depois do SaveXML já deixou o documento guardado: não se repete
+	if p.DocumentoId > 0 {
+		documentoID = p.DocumentoId
+		log.Printf("Pedido %s retomado com o documento %d já guardado\n", id, documentoID)
+	} else {
+		documentoID, err = SaveXML(db, id, xmlFinal, p.MapperVersion, relatorio.Versao, fonte, rejeitados)
+	}
+	marcar("persistencia")
+	if err != nil {
+		terminar(EstadoFailed, "ERRO_PERSISTENCIA")
+		return
+	}
+
+	// 5. Diferenças para o upload anterior da mesma fonte; o documento já está guardado, por isso uma
+	// falha aqui só deixa o webhook sem o resumo do delta
+	if p.DocumentoId > 0 {
+		delta, _, err = GetRelatorioDelta(db, documentoID)
+	}
+	if delta == nil && err == nil {
+		delta, err = GerarDelta(db, p.EsquemaDelta, documentoID, id, fonte, &relatorio, rejeitados)
+	}
+	marcar("delta")
+	if err != nil {
+		log.Println("Erro ao gerar delta:", err)
+	}
+
+	publicarEvento(db, EventoDocumentStored, contexto, DocumentoGuardado{
+		DocumentoId:   documentoID,
+		Mapper:        p.MapperVersion,
+		FileName:      fname,
+		VersaoXSD:     relatorio.Versao,
+		TotalVeiculos: len(relatorio.Stock),
+		DataGeracao:   relatorio.DataGeracao,
+	})
+	for _, a := range alteracoesPreco(db, documentoID) {
+		c := contexto
+		c.Designacao = a.Designacao
+		publicarEvento(db, EventoVehiclePriceChange, c, a)
+	}
+
+	terminar(EstadoPersisted, "SUCCESS")
+}
+
+// situarErros liga cada erro do XSD/Schematron à linha do CSV de onde veio o Veiculo
+func situarErros(erros []ErroDocumento, linhasCSV []int) {
+	for i := range erros {
+		if v := erros[i].veiculo; v >= 0 && v < len(linhasCSV) {
+			erros[i].LinhaCSV = linhasCSV[v]
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severidade de uma regra de negócio: um erro retira o veículo do XML, um aviso só fica no relatório
+const (
+	SeveridadeErro  = "erro"
+	SeveridadeAviso = "aviso"
+)
+
+// Resultado das regras de negócio para um veículo
+const (
+	VeiculoAceite    = "ACEITE"
+	VeiculoComAvisos = "ACEITE_COM_AVISOS"
+	VeiculoRejeitado = "REJEITADO"
+)
+
+// Tipos de regra suportados
+const (
+	RegraIntervalo = "intervalo"  // Campo numérico entre min e max
+	RegraKmPorAno  = "km_por_ano" // Kilometragem plausível para a idade do veículo
+	RegraCaixaGPS  = "caixa_gps"  // Coordenadas dentro de uma bounding box
+	RegraUnico     = "unico"      // Valor do campo que não se pode repetir entre os veículos do upload
+)
+
+// Regra é uma regra de negócio declarativa, lida do ficheiro de regras (JSON/YAML)
+type Regra struct {
+	Nome       string         `json:"nome" yaml:"nome"`
+	Descricao  string         `json:"descricao" yaml:"descricao"`
+	Tipo       string         `json:"tipo" yaml:"tipo"`
+	Severidade string         `json:"severidade" yaml:"severidade"`
+	Quando     *CondicaoRegra `json:"quando" yaml:"quando"` // Só se aplica aos veículos que cumprem a condição
+
+	// intervalo e unico
+	Campo string `json:"campo" yaml:"campo"` // Campo XML, como nos mappers (ex: Identificacao/Preco)
+	Min   Limite `json:"min" yaml:"min"`
+	Max   Limite `json:"max" yaml:"max"`
+
+	// km_por_ano
+	MaximoPorAno float64 `json:"maximoPorAno" yaml:"maximoPorAno"`
+
+	// caixa_gps
+	LatMin float64 `json:"latMin" yaml:"latMin"`
+	LatMax float64 `json:"latMax" yaml:"latMax"`
+	LonMin float64 `json:"lonMin" yaml:"lonMin"`
+	LonMax float64 `json:"lonMax" yaml:"lonMax"`
+}
+
+// CondicaoRegra restringe uma regra aos veículos cujo campo tem um dos valores (sem distinguir maiúsculas)
+type CondicaoRegra struct {
+	Campo   string   `json:"campo" yaml:"campo"`
+	Valores []string `json:"valores" yaml:"valores"`
+}
+
+// Limite é um número ou uma expressão relativa ao ano atual ("ano_atual", "ano_atual+1").
+// Vazio significa sem limite.
+type Limite string
+
+func (l *Limite) UnmarshalJSON(b []byte) error {
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err == nil {
+		*l = Limite(n.String())
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*l = Limite(s)
+	return nil
+}
+
+// valor resolve o limite para o ano dado; ok é false quando não há limite
+func (l Limite) valor(ano int) (v float64, ok bool, err error) {
+	s := strings.ReplaceAll(string(l), " ", "")
+	if s == "" {
+		return 0, false, nil
+	}
+	if resto, relativo := strings.CutPrefix(s, "ano_atual"); relativo {
+		delta := 0
+		if resto != "" {
+			if delta, err = strconv.Atoi(resto); err != nil {
+				return 0, false, fmt.Errorf("limite inválido: %s", l)
+			}
+		}
+		return float64(ano + delta), true, nil
+	}
+	v, err = strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("limite inválido: %s", l)
+	}
+	return v, true, nil
+}
+
+// ViolacaoRegra é uma regra que um veículo não cumpriu
+type ViolacaoRegra struct {
+	Regra      string `json:"regra"`
+	Severidade string `json:"severidade"`
+	Campo      string `json:"campo,omitempty"`
+	Valor      string `json:"valor,omitempty"`
+	Mensagem   string `json:"mensagem"`
+}
+
+// ResultadoVeiculo é o resultado das regras de negócio para um veículo do CSV
+type ResultadoVeiculo struct {
+	IDInterno string          `json:"idInterno"`
+	LinhaCSV  int             `json:"linhaCsv"`
+	Resultado string          `json:"resultado"`
+	Violacoes []ViolacaoRegra `json:"violacoes,omitempty"`
+}
+
+// Campos de VeiculoXML que as regras podem ler, pelo mesmo caminho XML dos mappers
+var valoresVeiculo = map[string]func(v *VeiculoXML) interface{}{
+	"@IDInterno":                       func(v *VeiculoXML) interface{} { return v.Identificador },
+	"Identificacao/Designacao":         func(v *VeiculoXML) interface{} { return v.Identificacao.Designacao },
+	"Identificacao/Preco":              func(v *VeiculoXML) interface{} { return float64(v.Identificacao.Preco) },
+	"Identificacao/Ano":                func(v *VeiculoXML) interface{} { return float64(v.Identificacao.Ano) },
+	"Identificacao/Categoria":          func(v *VeiculoXML) interface{} { return v.Identificacao.CategoriaVeiculo },
+	"DetalhesTecnicos/Cilindrada":      func(v *VeiculoXML) interface{} { return float64(v.DetalhesTecnicos.Cilindrada) },
+	"DetalhesTecnicos/PotenciaMotor":   func(v *VeiculoXML) interface{} { return float64(v.DetalhesTecnicos.PotenciaMotor) },
+	"DetalhesTecnicos/TipoCombustivel": func(v *VeiculoXML) interface{} { return v.DetalhesTecnicos.TipoCombustivel },
+	"DetalhesTecnicos/TipoTransmissao": func(v *VeiculoXML) interface{} { return v.DetalhesTecnicos.TipoTransmissao },
+	"HistoricoUso/Kilometragem":        func(v *VeiculoXML) interface{} { return float64(v.HistoricoUso.Kilometragem) },
+	"Geografia/Cidade":                 func(v *VeiculoXML) interface{} { return v.Geografia.Cidade },
+	"Geografia/PosicionamentoGPS/@Lat": func(v *VeiculoXML) interface{} { return float64(v.Geografia.GPS.Lat) },
+	"Geografia/PosicionamentoGPS/@Lon": func(v *VeiculoXML) interface{} { return float64(v.Geografia.GPS.Lon) },
+}
+
+// MotorRegras aplica as regras de negócio a cada VeiculoXML (substitui o antigo validar)
+type MotorRegras struct {
+	Regras []Regra `json:"regras" yaml:"regras"`
+}
+
+// CarregarRegras lê o ficheiro de regras (.json, .yaml ou .yml) e verifica cada regra
+func CarregarRegras(ficheiro string) (*MotorRegras, error) {
+	conteudo, err := os.ReadFile(ficheiro)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MotorRegras{}
+	if strings.ToLower(filepath.Ext(ficheiro)) == ".json" {
+		err = json.Unmarshal(conteudo, m)
+	} else {
+		err = yaml.Unmarshal(conteudo, m)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nomes := map[string]bool{}
+	for i := range m.Regras {
+		r := &m.Regras[i]
+		if err := r.verificar(); err != nil {
+			return nil, fmt.Errorf("regra %q: %v", r.Nome, err)
+		}
+		if nomes[r.Nome] {
+			return nil, fmt.Errorf("regra %q repetida", r.Nome)
+		}
+		nomes[r.Nome] = true
+	}
+	return m, nil
+}
+
+// verificar garante que a regra só usa tipos, severidades e campos conhecidos
+func (r *Regra) verificar() error {
+	if r.Nome == "" {
+		return fmt.Errorf("regra sem nome")
+	}
+	if r.Severidade != SeveridadeErro && r.Severidade != SeveridadeAviso {
+		return fmt.Errorf("severidade desconhecida: %s", r.Severidade)
+	}
+	if r.Quando != nil {
+		if _, ok := valoresVeiculo[r.Quando.Campo]; !ok {
+			return fmt.Errorf("campo desconhecido na condição: %s", r.Quando.Campo)
+		}
+	}
+
+	switch r.Tipo {
+	case RegraIntervalo:
+		ler, ok := valoresVeiculo[r.Campo]
+		if !ok {
+			return fmt.Errorf("campo desconhecido: %s", r.Campo)
+		}
+		if _, numerico := ler(&VeiculoXML{}).(float64); !numerico {
+			return fmt.Errorf("campo %s não é numérico", r.Campo)
+		}
+		for _, l := range []Limite{r.Min, r.Max} {
+			if _, _, err := l.valor(0); err != nil {
+				return err
+			}
+		}
+	case RegraKmPorAno:
+		if r.MaximoPorAno <= 0 {
+			return fmt.Errorf("maximoPorAno tem de ser positivo")
+		}
+	case RegraCaixaGPS:
+		if r.LatMin >= r.LatMax || r.LonMin >= r.LonMax {
+			return fmt.Errorf("bounding box inválida")
+		}
+	case RegraUnico:
+		if _, ok := valoresVeiculo[r.Campo]; !ok {
+			return fmt.Errorf("campo desconhecido: %s", r.Campo)
+		}
+	default:
+		return fmt.Errorf("tipo desconhecido: %s", r.Tipo)
+	}
+	return nil
+}
+
+// VistosUpload guarda, para as regras unico, a linha do CSV do primeiro veículo aceite com cada valor.
+// Começa vazio em cada upload e passa por todas as chamadas a Avaliar.
+type VistosUpload map[string]int
+
+func chaveVisto(r *Regra, v *VeiculoXML) string {
+	return r.Nome + "\x00" + strings.TrimSpace(fmt.Sprint(valoresVeiculo[r.Campo](v)))
+}
+
+// Avaliar corre todas as regras sobre o veículo; o ano serve para os limites relativos ao ano atual.
+// Só um veículo que não é rejeitado fica em vistos, para que o valor repetido conte a partir do primeiro aceite.
+func (m *MotorRegras) Avaliar(v *VeiculoXML, linhaCSV int, ano int, vistos VistosUpload) ResultadoVeiculo {
+	res := ResultadoVeiculo{IDInterno: v.Identificador, LinhaCSV: linhaCSV, Resultado: VeiculoAceite}
+	var unicos []*Regra
+	for i := range m.Regras {
+		r := &m.Regras[i]
+		if !r.aplicaSe(v) {
+			continue
+		}
+		if r.Tipo == RegraUnico {
+			unicos = append(unicos, r)
+		}
+		violacao, falhou := r.avaliar(v, ano, vistos)
+		if !falhou {
+			continue
+		}
+		res.Violacoes = append(res.Violacoes, violacao)
+		if r.Severidade == SeveridadeErro {
+			res.Resultado = VeiculoRejeitado
+		} else if res.Resultado == VeiculoAceite {
+			res.Resultado = VeiculoComAvisos
+		}
+	}
+	if res.Resultado != VeiculoRejeitado {
+		for _, r := range unicos {
+			if _, visto := vistos[chaveVisto(r, v)]; !visto {
+				vistos[chaveVisto(r, v)] = linhaCSV
+			}
+		}
+	}
+	return res
+}
+
+func (r *Regra) aplicaSe(v *VeiculoXML) bool {
+	if r.Quando == nil {
+		return true
+	}
+	valor := fmt.Sprint(valoresVeiculo[r.Quando.Campo](v))
+	for _, aceite := range r.Quando.Valores {
+		if strings.EqualFold(strings.TrimSpace(valor), aceite) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Regra) avaliar(v *VeiculoXML, ano int, vistos VistosUpload) (ViolacaoRegra, bool) {
+	violacao := ViolacaoRegra{Regra: r.Nome, Severidade: r.Severidade, Mensagem: r.Descricao}
+
+	switch r.Tipo {
+	case RegraIntervalo:
+		x := valoresVeiculo[r.Campo](v).(float64)
+		min, temMin, _ := r.Min.valor(ano)
+		max, temMax, _ := r.Max.valor(ano)
+		if (temMin && x < min) || (temMax && x > max) {
+			violacao.Campo = r.Campo
+			violacao.Valor = formatarNumero(x)
+			if violacao.Mensagem == "" {
+				violacao.Mensagem = fmt.Sprintf("%s fora do intervalo [%s, %s]", r.Campo, limiteTexto(min, temMin), limiteTexto(max, temMax))
+			}
+			return violacao, true
+		}
+
+	case RegraKmPorAno:
+		// Um veículo do próprio ano conta como um ano de uso
+		idade := ano - v.Identificacao.Ano + 1
+		if idade < 1 {
+			idade = 1
+		}
+		if km := float64(v.HistoricoUso.Kilometragem); km > r.MaximoPorAno*float64(idade) {
+			violacao.Campo = "HistoricoUso/Kilometragem"
+			violacao.Valor = formatarNumero(km)
+			if violacao.Mensagem == "" {
+				violacao.Mensagem = fmt.Sprintf("mais de %s km por ano em %d anos", formatarNumero(r.MaximoPorAno), idade)
+			}
+			return violacao, true
+		}
+
+	case RegraCaixaGPS:
+		lat, lon := float64(v.Geografia.GPS.Lat), float64(v.Geografia.GPS.Lon)
+		if lat < r.LatMin || lat > r.LatMax || lon < r.LonMin || lon > r.LonMax {
+			violacao.Campo = "Geografia/PosicionamentoGPS"
+			violacao.Valor = formatarNumero(lat) + "," + formatarNumero(lon)
+			if violacao.Mensagem == "" {
+				violacao.Mensagem = "coordenadas fora da área permitida"
+			}
+			return violacao, true
+		}
+
+	case RegraUnico:
+		if linha, visto := vistos[chaveVisto(r, v)]; visto {
+			violacao.Campo = r.Campo
+			violacao.Valor = fmt.Sprint(valoresVeiculo[r.Campo](v))
+			if violacao.Mensagem == "" {
+				violacao.Mensagem = r.Campo + " repetido"
+			}
+			violacao.Mensagem += fmt.Sprintf(" (já na linha %d)", linha)
+			return violacao, true
+		}
+	}
+	return violacao, false
+}
+
+func formatarNumero(x float64) string {
+	return strconv.FormatFloat(x, 'f', -1, 64)
+}
+
+func limiteTexto(x float64, existe bool) string {
+	if !existe {
+		return "-"
+	}
+	return formatarNumero(x)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func veiculoRegras(id string, preco float64) VeiculoXML {
+	v := VeiculoXML{Identificador: id}
+	v.Identificacao.Designacao = "Renault Clio"
+	v.Identificacao.Preco = numeroXML(preco)
+	v.Identificacao.Ano = 2020
+	v.DetalhesTecnicos.Cilindrada = 1200
+	v.DetalhesTecnicos.PotenciaMotor = 90
+	v.DetalhesTecnicos.TipoCombustivel = "Gasolina"
+	v.HistoricoUso.Kilometragem = 50000
+	v.Geografia.Cidade = "Lisboa"
+	v.Geografia.GPS.Lat = 38.7223
+	v.Geografia.GPS.Lon = -9.1393
+	return v
+}
+
+// Um IDInterno repetido rejeita só as linhas repetidas, a contar do primeiro veículo aceite
+func TestRegraIDUnico(t *testing.T) {
+	regras, err := CarregarRegras("regras.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stock := []VeiculoXML{
+		veiculoRegras("A", 10000),
+		veiculoRegras("A", 11000), // repetido: rejeitado
+		veiculoRegras("B", 0),     // preço inválido: rejeitado e não conta como visto
+		veiculoRegras("B", 12000),
+		veiculoRegras("C", 13000),
+		veiculoRegras(" A ", 14000), // o mesmo IDInterno com espaços
+	}
+	esperado := []string{VeiculoAceite, VeiculoRejeitado, VeiculoRejeitado, VeiculoAceite, VeiculoAceite, VeiculoRejeitado}
+
+	vistos := VistosUpload{}
+	for i := range stock {
+		res := regras.Avaliar(&stock[i], i+2, 2026, vistos)
+		if res.Resultado != esperado[i] {
+			t.Errorf("linha %d (%s): %s, esperado %s %+v", i+2, stock[i].Identificador, res.Resultado, esperado[i], res.Violacoes)
+		}
+	}
+
+	res := regras.Avaliar(&stock[1], 3, 2026, VistosUpload{"id_unico\x00A": 2})
+	if len(res.Violacoes) != 1 || res.Violacoes[0].Regra != "id_unico" || !strings.Contains(res.Violacoes[0].Mensagem, "linha 2") {
+		t.Errorf("violações: %+v", res.Violacoes)
+	}
+}
+
+// O Schematron só avisa do IDInterno repetido: já não rejeita o documento inteiro
+func TestSchematronIDRepetidoSoAvisa(t *testing.T) {
+	esquemas, err := CarregarEsquemas("schemas", "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relatorio := ListaVeiculos{DataGeracao: "2026-10-17", Versao: "1.0",
+		Stock: []VeiculoXML{veiculoRegras("A", 10000), veiculoRegras("A", 11000)}}
+	relatorio.Configuracao.ValidadoPor = "XML_Service_ID_teste"
+	relatorio.Configuracao.Requisitante = "Processador_ID_teste"
+	xmlBytes, err := xml.Marshal(relatorio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, msg, erros := validarComSchematron(esquemas, xml.Header+string(xmlBytes))
+	if !ok {
+		t.Errorf("rejeitado pelo Schematron: %s %+v", msg, erros)
+	}
+	if len(erros) != 1 || erros[0].Severidade != "aviso" {
+		t.Errorf("esperado um aviso de IDInterno repetido: %+v", erros)
+	}
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Eventos a que uma subscrição se pode registar
+const (
+	EventoJobCompleted       = "job.completed"
+	EventoJobFailed          = "job.failed"
+	EventoDocumentStored     = "document.stored"
+	EventoVehiclePriceChange = "vehicle.price_changed"
+)
+
+var eventosConhecidos = map[string]bool{
+	EventoJobCompleted:       true,
+	EventoJobFailed:          true,
+	EventoDocumentStored:     true,
+	EventoVehiclePriceChange: true,
+}
+
+// Subscricao regista um URL que recebe os eventos indicados.
+// Cada subscrição tem o seu segredo para a assinatura HMAC (ver pacote assinatura).
+type Subscricao struct {
+	Id              int64             `json:"id"`
+	URL             string            `json:"url"`
+	Eventos         []string          `json:"eventos"`
+	Segredo         string            `json:"segredo,omitempty"` // Só é devolvido na criação
+	Filtros         FiltrosSubscricao `json:"filtros"`
+	Ativa           bool              `json:"ativa"`
+	DataCriacao     time.Time         `json:"dataCriacao"`
+	DataAtualizacao time.Time         `json:"dataAtualizacao"`
+}
+
+// FiltrosSubscricao restringe os eventos entregues; campos vazios não filtram
+type FiltrosSubscricao struct {
+	Mapper   string `json:"mapper,omitempty"`   // Versão do mapper do upload
+	FileName string `json:"fileName,omitempty"` // Prefixo do nome do ficheiro
+	Marca    string `json:"marca,omitempty"`    // Texto contido na Designacao (eventos vehicle.*)
+}
+
+// contextoEvento são os dados do evento usados para aplicar os filtros
+type contextoEvento struct {
+	RequestId  string
+	Mapper     string
+	FileName   string
+	Designacao string
+}
+
+func (f FiltrosSubscricao) aceita(c contextoEvento) bool {
+	if f.Mapper != "" && f.Mapper != c.Mapper {
+		return false
+	}
+	if f.FileName != "" && !strings.HasPrefix(c.FileName, f.FileName) {
+		return false
+	}
+	if f.Marca != "" && !strings.Contains(strings.ToLower(c.Designacao), strings.ToLower(f.Marca)) {
+		return false
+	}
+	return true
+}
+
+// EventoWebhook é o envelope entregue às subscrições
+type EventoWebhook struct {
+	Evento     string      `json:"evento"`
+	DataEvento time.Time   `json:"dataEvento"`
+	RequestId  string      `json:"requestId"`
+	Dados      interface{} `json:"dados"`
+}
+
+// DocumentoGuardado são os dados do evento document.stored
+type DocumentoGuardado struct {
+	DocumentoId   int64  `json:"documentoId"`
+	Mapper        string `json:"mapper"`
+	FileName      string `json:"fileName"`
+	VersaoXSD     string `json:"versaoXsd"`
+	TotalVeiculos int    `json:"totalVeiculos"`
+	DataGeracao   string `json:"dataGeracao"`
+}
+
+// AlteracaoPreco são os dados do evento vehicle.price_changed
+type AlteracaoPreco struct {
+	IDInterno     string  `json:"idInterno"`
+	Designacao    string  `json:"designacao"`
+	PrecoAnterior float64 `json:"precoAnterior"`
+	PrecoNovo     float64 `json:"precoNovo"`
+	DocumentoId   int64   `json:"documentoId"`
+}
+
+// publicarEvento cria uma entrega na outbox para cada subscrição ativa que aceita o evento
+func publicarEvento(db *sql.DB, evento string, c contextoEvento, dados interface{}) {
+	subs, err := ListSubscricoesEvento(db, evento)
+	if err != nil {
+		return
+	}
+
+	payload, _ := json.Marshal(EventoWebhook{Evento: evento, DataEvento: time.Now(), RequestId: c.RequestId, Dados: dados})
+	for _, s := range subs {
+		if !s.Filtros.aceita(c) {
+			continue
+		}
+		inserirEntrega(db, sql.NullInt64{Int64: s.Id, Valid: true}, evento, c.RequestId, s.URL, payload)
+	}
+}
+
+// alteracoesPreco devolve as mudanças de preço que o documento trouxe, a partir do histórico gravado
+// pelo SaveXML (veiculos_historico). O preço anterior é o último conhecido do IDInterno, venha de
+// que documento vier; a primeira observação de um veículo não conta como alteração.
+func alteracoesPreco(db *sql.DB, documentoID int64) []AlteracaoPreco {
+	query := `
+		SELECT h.id_interno, COALESCE(v.designacao, ''), h.preco_anterior, h.preco
+		FROM veiculos_historico h
+		LEFT JOIN LATERAL (
+			SELECT designacao FROM veiculos
+			WHERE documento_id = h.documento_id AND id_interno = h.id_interno
+			ORDER BY posicao DESC
+			LIMIT 1
+		) v ON true
+		WHERE h.documento_id = $1 AND h.preco IS NOT NULL AND h.preco_anterior IS NOT NULL AND h.preco <> h.preco_anterior
+		ORDER BY h.id`
+	rows, err := db.Query(query, documentoID)
+	if err != nil {
+		log.Println("Erro ao ler alterações de preço:", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var alteracoes []AlteracaoPreco
+	for rows.Next() {
+		a := AlteracaoPreco{DocumentoId: documentoID}
+		if err := rows.Scan(&a.IDInterno, &a.Designacao, &a.PrecoAnterior, &a.PrecoNovo); err != nil {
+			log.Println("Erro ao ler alterações de preço:", err)
+			return nil
+		}
+		alteracoes = append(alteracoes, a)
+	}
+	return alteracoes
+}
+
+// --- Base de dados ---
+
+const colunasSubscricao = `id, url, eventos, filtros, ativa, data_criacao, data_atualizacao`
+
+func lerSubscricao(scan func(...interface{}) error) (*Subscricao, error) {
+	s := &Subscricao{}
+	var filtros []byte
+	err := scan(&s.Id, &s.URL, pq.Array(&s.Eventos), &filtros, &s.Ativa, &s.DataCriacao, &s.DataAtualizacao)
+	if err != nil {
+		return nil, err
+	}
+	json.Unmarshal(filtros, &s.Filtros)
+	return s, nil
+}
+
+func CreateSubscricao(db *sql.DB, s *Subscricao) error {
+	filtros, _ := json.Marshal(s.Filtros)
+	agora := time.Now()
+	query := `INSERT INTO subscricoes (url, eventos, segredo, filtros, ativa, data_criacao, data_atualizacao)
+		VALUES ($1, $2, $3, $4, $5, $6, $6) RETURNING id`
+	err := db.QueryRow(query, s.URL, pq.Array(s.Eventos), s.Segredo, string(filtros), s.Ativa, agora).Scan(&s.Id)
+	if err != nil {
+		log.Println("Erro ao criar subscrição:", err)
+		return err
+	}
+	s.DataCriacao, s.DataAtualizacao = agora, agora
+	return nil
+}
+
+func UpdateSubscricao(db *sql.DB, s *Subscricao) (bool, error) {
+	filtros, _ := json.Marshal(s.Filtros)
+	query := `UPDATE subscricoes SET url = $2, eventos = $3, filtros = $4, ativa = $5, data_atualizacao = $6
+		WHERE id = $1`
+	res, err := db.Exec(query, s.Id, s.URL, pq.Array(s.Eventos), string(filtros), s.Ativa, time.Now())
+	if err != nil {
+		log.Println("Erro ao atualizar subscrição:", err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func DeleteSubscricao(db *sql.DB, id int64) (bool, error) {
+	res, err := db.Exec(`DELETE FROM subscricoes WHERE id = $1`, id)
+	if err != nil {
+		log.Println("Erro ao remover subscrição:", err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func GetSubscricao(db *sql.DB, id int64) (*Subscricao, error) {
+	row := db.QueryRow(`SELECT `+colunasSubscricao+` FROM subscricoes WHERE id = $1`, id)
+	s, err := lerSubscricao(row.Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.Println("Erro ao ler subscrição:", err)
+	}
+	return s, err
+}
+
+func ListSubscricoes(db *sql.DB) ([]*Subscricao, error) {
+	return listarSubscricoes(db, `SELECT `+colunasSubscricao+` FROM subscricoes ORDER BY id`)
+}
+
+// ListSubscricoesEvento devolve as subscrições ativas registadas para o evento
+func ListSubscricoesEvento(db *sql.DB, evento string) ([]*Subscricao, error) {
+	return listarSubscricoes(db, `SELECT `+colunasSubscricao+` FROM subscricoes WHERE ativa AND $1 = ANY(eventos) ORDER BY id`, evento)
+}
+
+func listarSubscricoes(db *sql.DB, query string, args ...interface{}) ([]*Subscricao, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Println("Erro ao listar subscrições:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []*Subscricao{}
+	for rows.Next() {
+		s, err := lerSubscricao(rows.Scan)
+		if err != nil {
+			log.Println("Erro ao listar subscrições:", err)
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+// GetSegredoSubscricao devolve o segredo usado para assinar as entregas da subscrição
+func GetSegredoSubscricao(db *sql.DB, id int64) (string, error) {
+	var segredo string
+	err := db.QueryRow(`SELECT segredo FROM subscricoes WHERE id = $1`, id).Scan(&segredo)
+	return segredo, err
+}
+
+// --- HTTP ---
+
+// pedidoSubscricao é o corpo aceite em POST e PUT /subscricoes
+type pedidoSubscricao struct {
+	URL     string            `json:"url"`
+	Eventos []string          `json:"eventos"`
+	Segredo string            `json:"segredo"`
+	Filtros FiltrosSubscricao `json:"filtros"`
+	Ativa   *bool             `json:"ativa"`
+}
+
+func (p pedidoSubscricao) verificar() error {
+	if !strings.HasPrefix(p.URL, "http://") && !strings.HasPrefix(p.URL, "https://") {
+		return fmt.Errorf("url inválido")
+	}
+	if len(p.Eventos) == 0 {
+		return fmt.Errorf("indique pelo menos um evento")
+	}
+	for _, e := range p.Eventos {
+		if !eventosConhecidos[e] {
+			return fmt.Errorf("evento desconhecido: %s", e)
+		}
+	}
+	return nil
+}
+
+// registarRotasSubscricoes adiciona o CRUD de /subscricoes, protegido pelo mesmo token das rotas /admin:
+// uma subscrição recebe os payloads de todos os uploads. Sem token as rotas não são registadas.
+func registarRotasSubscricoes(db *sql.DB, token string) {
+	if token == "" {
+		log.Println("! ADMIN_TOKEN não definido: rotas /subscricoes desativadas")
+		return
+	}
+
+	http.HandleFunc("GET /subscricoes", protegerAdmin(token, func(w http.ResponseWriter, r *http.Request) {
+		subs, err := ListSubscricoes(db)
+		if err != nil {
+			http.Error(w, "Erro ao listar subscrições", 500)
+			return
+		}
+		responderJSON(w, http.StatusOK, subs)
+	}))
+
+	http.HandleFunc("POST /subscricoes", protegerAdmin(token, func(w http.ResponseWriter, r *http.Request) {
+		var p pedidoSubscricao
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "JSON inválido", 400)
+			return
+		}
+		if err := p.verificar(); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		s := &Subscricao{URL: p.URL, Eventos: p.Eventos, Segredo: p.Segredo, Filtros: p.Filtros, Ativa: true}
+		if p.Ativa != nil {
+			s.Ativa = *p.Ativa
+		}
+		if s.Segredo == "" {
+			s.Segredo = novoDeliveryID() + novoDeliveryID()
+		}
+		if err := CreateSubscricao(db, s); err != nil {
+			http.Error(w, "Erro ao criar subscrição", 500)
+			return
+		}
+		// O segredo só é mostrado nesta resposta
+		responderJSON(w, http.StatusCreated, s)
+	}))
+
+	http.HandleFunc("GET /subscricoes/{id}", protegerAdmin(token, func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "id inválido", 400)
+			return
+		}
+		s, err := GetSubscricao(db, id)
+		if err != nil {
+			http.Error(w, "Erro ao ler subscrição", 500)
+			return
+		}
+		if s == nil {
+			http.Error(w, "Subscrição não encontrada", 404)
+			return
+		}
+		responderJSON(w, http.StatusOK, s)
+	}))
+
+	http.HandleFunc("PUT /subscricoes/{id}", protegerAdmin(token, func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "id inválido", 400)
+			return
+		}
+		var p pedidoSubscricao
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "JSON inválido", 400)
+			return
+		}
+		if err := p.verificar(); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		s := &Subscricao{Id: id, URL: p.URL, Eventos: p.Eventos, Filtros: p.Filtros, Ativa: true}
+		if p.Ativa != nil {
+			s.Ativa = *p.Ativa
+		}
+		ok, err := UpdateSubscricao(db, s)
+		if err != nil {
+			http.Error(w, "Erro ao atualizar subscrição", 500)
+			return
+		}
+		if !ok {
+			http.Error(w, "Subscrição não encontrada", 404)
+			return
+		}
+		s, _ = GetSubscricao(db, id)
+		responderJSON(w, http.StatusOK, s)
+	}))
+
+	http.HandleFunc("DELETE /subscricoes/{id}", protegerAdmin(token, func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "id inválido", 400)
+			return
+		}
+		ok, err := DeleteSubscricao(db, id)
+		if err != nil {
+			http.Error(w, "Erro ao remover subscrição", 500)
+			return
+		}
+		if !ok {
+			http.Error(w, "Subscrição não encontrada", 404)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
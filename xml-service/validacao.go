@@ -0,0 +1,97 @@
+package main
+
+// Resultado final da validação linha a linha de um upload
+const (
+	ResultadoAceite    = "ACEITE"         // Todas as linhas foram aceites
+	ResultadoParcial   = "ACEITE_PARCIAL" // Algumas linhas foram rejeitadas
+	ResultadoRejeitado = "REJEITADO"      // Nenhuma linha foi aceite
+)
+
+// ErroCelula descreve uma célula do CSV que não pôde ser convertida
+type ErroCelula struct {
+	Linha  int    `json:"linha"` // Linha no ficheiro CSV (o cabeçalho é a linha 1)
+	Coluna string `json:"coluna"`
+	Valor  string `json:"valor"`
+	Motivo string `json:"motivo"`
+}
+
+// ErroDocumento é um erro do libxml2 ao validar o XML gerado (XSD ou Schematron), ligado de volta
+// à linha do CSV
+type ErroDocumento struct {
+	LinhaXML   int    `json:"linhaXml"`
+	LinhaCSV   int    `json:"linhaCsv,omitempty"`  // Linha do CSV que deu origem ao Veiculo
+	Caminho    string `json:"caminho"`             // XPath do nó que falhou
+	IDInterno  string `json:"idInterno,omitempty"` // IDInterno do Veiculo onde está o nó
+	Mensagem   string `json:"mensagem"`
+	Severidade string `json:"severidade"` // erro, ou aviso para um <report> do Schematron
+
+	veiculo int // Posição do Veiculo no Stock (-1 se o erro não está dentro de um Veiculo)
+}
+
+// RelatorioValidacao resume a passagem de validação sobre as linhas do CSV
+type RelatorioValidacao struct {
+	Resultado        string          `json:"resultado"`
+	LinhasLidas      int             `json:"linhasLidas"`
+	LinhasAceites    int             `json:"linhasAceites"`
+	LinhasRejeitadas int             `json:"linhasRejeitadas"`
+	Erros            []ErroCelula    `json:"erros"`
+	ErrosXSD         []ErroDocumento `json:"errosXsd,omitempty"`
+	ErrosSchematron  []ErroDocumento `json:"errosSchematron,omitempty"` // Asserções falhadas e reports
+
+	// Resultado das regras de negócio para cada veículo que passou na conversão
+	Veiculos []ResultadoVeiculo `json:"veiculos,omitempty"`
+}
+
+// registarLinha contabiliza uma linha; qualquer erro numa célula rejeita a linha inteira
+func (r *RelatorioValidacao) registarLinha(erros []ErroCelula) bool {
+	r.LinhasLidas++
+	if len(erros) > 0 {
+		r.LinhasRejeitadas++
+		r.Erros = append(r.Erros, erros...)
+		return false
+	}
+	r.LinhasAceites++
+	return true
+}
+
+// registarVeiculo guarda o resultado das regras de negócio; um veículo rejeitado
+// passa a contar como linha rejeitada
+func (r *RelatorioValidacao) registarVeiculo(res ResultadoVeiculo) bool {
+	r.Veiculos = append(r.Veiculos, res)
+	if res.Resultado == VeiculoRejeitado {
+		r.LinhasAceites--
+		r.LinhasRejeitadas++
+		return false
+	}
+	return true
+}
+
+// concluir calcula o resultado final depois de todas as linhas lidas
+func (r *RelatorioValidacao) concluir() {
+	switch {
+	case r.LinhasAceites == 0:
+		r.Resultado = ResultadoRejeitado
+	case r.LinhasRejeitadas > 0:
+		r.Resultado = ResultadoParcial
+	default:
+		r.Resultado = ResultadoAceite
+	}
+	if r.Erros == nil {
+		r.Erros = []ErroCelula{}
+	}
+}
+
+// Rejeitados identifica os veículos das linhas rejeitadas, que ficam fora do XML sem terem saído do
+// stock da fonte (ver registarAnuncios e GerarDelta)
+type Rejeitados struct {
+	IDs   []string // IDInterno das linhas rejeitadas
+	SemID int      // Linhas rejeitadas sem um IDInterno válido
+}
+
+func (r *Rejeitados) juntar(idInterno string) {
+	if idInterno == "" {
+		r.SemID++
+		return
+	}
+	r.IDs = append(r.IDs, idInterno)
+}
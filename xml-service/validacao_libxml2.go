@@ -0,0 +1,249 @@
+package main
+
+/*
+#cgo pkg-config: libxml-2.0
+#include <stdint.h>
+#include <stdlib.h>
+#include <string.h>
+#include <libxml/xmlversion.h>
+#include <libxml/tree.h>
+#include <libxml/xmlerror.h>
+#include <libxml/xmlschemas.h>
+#include <libxml/schematron.h>
+
+// A partir do libxml2 2.12 o handler recebe um const xmlError*
+#if LIBXML_VERSION >= 21200
+#define ERRO_LIBXML_CONST const
+#else
+#define ERRO_LIBXML_CONST
+#endif
+
+#define MAX_ERROS_DOCUMENTO 1000
+
+typedef struct erroDocumento {
+	int linha;
+	int veiculo;
+	int aviso;
+	char *mensagem;
+	char *caminho;
+	char *idInterno;
+	struct erroDocumento *seguinte;
+} erroDocumento;
+
+typedef struct {
+	erroDocumento *primeiro;
+	erroDocumento *ultimo;
+	int total;
+} listaErros;
+
+static char *copiarXmlChar(xmlChar *s) {
+	char *c = NULL;
+	if (s != NULL) {
+		c = strdup((const char *) s);
+		xmlFree(s);
+	}
+	return c;
+}
+
+// Sobe a partir do nó com erro até ao Veiculo que o contém e conta os Veiculo anteriores,
+// para saber a posição no Stock (e daí a linha do CSV)
+static void procurarVeiculo(xmlNodePtr no, erroDocumento *e) {
+	xmlNodePtr p, irmao;
+	for (p = no; p != NULL; p = p->parent) {
+		if (p->type == XML_ELEMENT_NODE && xmlStrEqual(p->name, BAD_CAST "Veiculo")) {
+			e->idInterno = copiarXmlChar(xmlGetProp(p, BAD_CAST "IDInterno"));
+			e->veiculo = 0;
+			for (irmao = p->prev; irmao != NULL; irmao = irmao->prev) {
+				if (irmao->type == XML_ELEMENT_NODE && xmlStrEqual(irmao->name, BAD_CAST "Veiculo")) {
+					e->veiculo++;
+				}
+			}
+			return;
+		}
+	}
+}
+
+static void coletarErro(void *ctx, ERRO_LIBXML_CONST xmlError *err) {
+	listaErros *lista = (listaErros *) ctx;
+	erroDocumento *e;
+	xmlNodePtr no;
+
+	if (err == NULL || lista->total >= MAX_ERROS_DOCUMENTO) {
+		return;
+	}
+	e = (erroDocumento *) calloc(1, sizeof(erroDocumento));
+	if (e == NULL) {
+		return;
+	}
+	e->linha = err->line;
+	e->veiculo = -1;
+	// No Schematron, um <report> que dispara é informativo; só os <assert> falhados são erros
+	e->aviso = err->domain == XML_FROM_SCHEMATRONV && err->code == XML_SCHEMATRONV_REPORT;
+	if (err->message != NULL) {
+		e->mensagem = strdup(err->message);
+	}
+
+	no = (xmlNodePtr) err->node;
+	if (no != NULL) {
+		e->caminho = copiarXmlChar(xmlGetNodePath(no));
+		if (e->linha <= 0) {
+			e->linha = (int) xmlGetLineNo(no);
+		}
+		procurarVeiculo(no, e);
+	}
+
+	if (lista->ultimo == NULL) {
+		lista->primeiro = e;
+	} else {
+		lista->ultimo->seguinte = e;
+	}
+	lista->ultimo = e;
+	lista->total++;
+}
+
+static int validarDocumentoXSD(uintptr_t schema, uintptr_t doc, listaErros *lista) {
+	int r;
+	xmlSchemaValidCtxtPtr ctx = xmlSchemaNewValidCtxt((xmlSchemaPtr) schema);
+	if (ctx == NULL) {
+		return -1;
+	}
+	xmlSchemaSetValidStructuredErrors(ctx, coletarErro, lista);
+	r = xmlSchemaValidateDoc(ctx, (xmlDocPtr) doc);
+	xmlSchemaFreeValidCtxt(ctx);
+	return r;
+}
+
+static xmlSchematronPtr compilarSchematron(const char *ficheiro) {
+	xmlSchematronPtr sch;
+	xmlSchematronParserCtxtPtr ctx = xmlSchematronNewParserCtxt(ficheiro);
+	if (ctx == NULL) {
+		return NULL;
+	}
+	sch = xmlSchematronParse(ctx);
+	xmlSchematronFreeParserCtxt(ctx);
+	return sch;
+}
+
+static int validarDocumentoSchematron(xmlSchematronPtr sch, uintptr_t doc, listaErros *lista) {
+	int r;
+	xmlSchematronValidCtxtPtr ctx = xmlSchematronNewValidCtxt(sch, XML_SCHEMATRON_OUT_ERROR);
+	if (ctx == NULL) {
+		return -1;
+	}
+	xmlSchematronSetValidStructuredErrors(ctx, coletarErro, lista);
+	r = xmlSchematronValidateDoc(ctx, (xmlDocPtr) doc);
+	xmlSchematronFreeValidCtxt(ctx);
+	return r;
+}
+
+static void libertarErros(listaErros *lista) {
+	erroDocumento *e = lista->primeiro, *seguinte;
+	while (e != NULL) {
+		seguinte = e->seguinte;
+		free(e->mensagem);
+		free(e->caminho);
+		free(e->idInterno);
+		free(e);
+		e = seguinte;
+	}
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"strings"
+	"unsafe"
+
+	"github.com/lestrrat-go/libxml2/types"
+	"github.com/lestrrat-go/libxml2/xsd"
+)
+
+// validarDocumentoXSD valida com o libxml2 diretamente, em vez de schema.Validate, porque o
+// go-libxml2 só devolve o texto das mensagens. Aqui cada erro traz a linha, o nó e o Veiculo.
+// O erro devolvido é só para falhas do próprio validador; um documento inválido devolve a lista.
+func validarDocumentoXSD(schema *xsd.Schema, doc types.Document) ([]ErroDocumento, error) {
+	var lista C.listaErros
+	defer C.libertarErros(&lista)
+
+	r := C.validarDocumentoXSD(C.uintptr_t(schema.Pointer()), C.uintptr_t(doc.Pointer()), &lista)
+	if r < 0 {
+		return nil, errors.New("falha interna do validador XSD")
+	}
+	return errosDocumento(&lista, r > 0), nil
+}
+
+// Schematron é um ficheiro .sch (ISO Schematron) compilado pelo libxml2
+type Schematron struct {
+	ptr C.xmlSchematronPtr
+}
+
+// CompilarSchematron lê e compila o ficheiro .sch
+func CompilarSchematron(ficheiro string) (*Schematron, error) {
+	cFicheiro := C.CString(ficheiro)
+	defer C.free(unsafe.Pointer(cFicheiro))
+
+	ptr := C.compilarSchematron(cFicheiro)
+	if ptr == nil {
+		return nil, errors.New("Schematron inválido: " + ficheiro)
+	}
+	return &Schematron{ptr: ptr}, nil
+}
+
+// Free liberta o Schematron compilado
+func (s *Schematron) Free() {
+	if s.ptr != nil {
+		C.xmlSchematronFree(s.ptr)
+		s.ptr = nil
+	}
+}
+
+// Validar corre as regras do Schematron sobre o documento. Devolve as asserções falhadas
+// (Severidade erro) e os reports disparados (Severidade aviso).
+func (s *Schematron) Validar(doc types.Document) ([]ErroDocumento, error) {
+	var lista C.listaErros
+	defer C.libertarErros(&lista)
+
+	r := C.validarDocumentoSchematron(s.ptr, C.uintptr_t(doc.Pointer()), &lista)
+	if r < 0 {
+		return nil, errors.New("falha interna do validador Schematron")
+	}
+	// O resultado também conta os reports disparados, por isso só a lista distingue erros de avisos
+	return errosDocumento(&lista, false), nil
+}
+
+// errosDocumento copia a lista do C; invalido indica que o libxml2 rejeitou o documento
+func errosDocumento(lista *C.listaErros, invalido bool) []ErroDocumento {
+	erros := []ErroDocumento{}
+	temErro := false
+	for e := lista.primeiro; e != nil; e = e.seguinte {
+		caminho := C.GoString(e.caminho)
+		mensagem := strings.TrimSpace(C.GoString(e.mensagem))
+		// O Schematron repete o nó e a linha no texto ("/caminho line 3: mensagem")
+		if resto, ok := strings.CutPrefix(mensagem, caminho+" line "); ok && caminho != "" {
+			if _, texto, ok := strings.Cut(resto, ": "); ok {
+				mensagem = texto
+			}
+		}
+
+		severidade := SeveridadeErro
+		if e.aviso != 0 {
+			severidade = SeveridadeAviso
+		} else {
+			temErro = true
+		}
+		erros = append(erros, ErroDocumento{
+			LinhaXML:   int(e.linha),
+			Caminho:    caminho,
+			IDInterno:  C.GoString(e.idInterno),
+			Mensagem:   mensagem,
+			Severidade: severidade,
+			veiculo:    int(e.veiculo),
+		})
+	}
+	if invalido && !temErro {
+		// O libxml2 rejeitou sem chamar o handler; não deixa o documento passar
+		erros = append(erros, ErroDocumento{Mensagem: "documento inválido", Severidade: SeveridadeErro, veiculo: -1})
+	}
+	return erros
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// projecaoVeiculos desfaz o Stock em linhas da tabela veiculos. O XMLTABLE percorre um nó Veiculo
+// de cada vez e lê os campos relativos a esse nó, por isso cada linha só tem valores do próprio
+// veículo: um elemento em falta fica NULL (e sai das médias) em vez de desalinhar os outros veículos,
+// como acontecia com vários unnest(xpath(...)) lado a lado.
+const projecaoVeiculos = `
+	INSERT INTO veiculos (documento_id, posicao, id_interno, designacao, categoria, preco, ano,
+		cilindrada, potencia, combustivel, transmissao, kms, cidade, lat, lon, data_documento)
+	SELECT
+		d.id,
+		v.posicao - 1,
+		v.id_interno,
+		NULLIF(v.designacao, ''),
+		NULLIF(v.categoria, ''),
+		NULLIF(trim(v.preco), '')::numeric,
+		NULLIF(trim(v.ano), '')::integer,
+		NULLIF(trim(v.cilindrada), '')::integer,
+		NULLIF(trim(v.potencia), '')::integer,
+		NULLIF(v.combustivel, ''),
+		NULLIF(v.transmissao, ''),
+		NULLIF(trim(v.kms), '')::numeric,
+		NULLIF(v.cidade, ''),
+		NULLIF(trim(v.lat), '')::double precision,
+		NULLIF(trim(v.lon), '')::double precision,
+		d.data_criacao
+	FROM veiculos_xml d,
+		XMLTABLE('/RelatorioVeiculos/Stock/Veiculo' PASSING d.xml_documento
+			COLUMNS
+				posicao     FOR ORDINALITY,
+				id_interno  text PATH '@IDInterno',
+				designacao  text PATH 'Identificacao/Designacao',
+				categoria   text PATH 'Identificacao/Categoria',
+				preco       text PATH 'Identificacao/Preco',
+				ano         text PATH 'Identificacao/Ano',
+				cilindrada  text PATH 'DetalhesTecnicos/Cilindrada',
+				potencia    text PATH 'DetalhesTecnicos/PotenciaMotor',
+				combustivel text PATH 'DetalhesTecnicos/TipoCombustivel',
+				transmissao text PATH 'DetalhesTecnicos/TipoTransmissao',
+				kms         text PATH 'HistoricoUso/Kilometragem',
+				cidade      text PATH 'Geografia/Cidade',
+				lat         text PATH 'Geografia/PosicionamentoGPS/@Lat',
+				lon         text PATH 'Geografia/PosicionamentoGPS/@Lon'
+		) v
+	-- Sem IDInterno não há como juntar as observações do mesmo veículo (o XSD já o exige)
+	WHERE v.id_interno IS NOT NULL`
+
+// projetarVeiculos gera as linhas de veiculos de um documento, na transação do SaveXML,
+// para que a projeção nunca fique atrás dos documentos
+func projetarVeiculos(tx *sql.Tx, documentoID int64) (int, error) {
+	res, err := tx.Exec(projecaoVeiculos+` AND d.id = $1`, documentoID)
+	if err != nil {
+		return 0, fmt.Errorf("documento %d: %v", documentoID, err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// ReconstruirVeiculos apaga a projeção, as observações atuais, o histórico e os anúncios e volta a
+// gerá-los a partir de todos os documentos guardados.
+// Corre numa só transação: as estatísticas continuam a ler a projeção antiga até ao fim.
+func ReconstruirVeiculos(db *sql.DB) (documentos int, veiculos int, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	// Impede um SaveXML de inserir um documento a meio da reconstrução
+	if _, err := tx.Exec(`LOCK TABLE veiculos IN EXCLUSIVE MODE`); err != nil {
+		return 0, 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM veiculos`); err != nil {
+		return 0, 0, err
+	}
+	res, err := tx.Exec(projecaoVeiculos)
+	if err != nil {
+		return 0, 0, err
+	}
+	n, _ := res.RowsAffected()
+	if err := reconstruirObservacoes(tx); err != nil {
+		return 0, 0, err
+	}
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM veiculos_xml`).Scan(&documentos); err != nil {
+		return 0, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return documentos, int(n), nil
+}
+
+// reconstruirObservacoes volta a gerar as observações atuais, o histórico e os anúncios a partir da projeção, documento a
+// documento pela ordem em que foram guardados, como se estivessem a chegar agora
+func reconstruirObservacoes(tx *sql.Tx) error {
+	for _, tabela := range []string{"veiculos_atuais", "veiculos_historico", "veiculos_resumo", "anuncios"} {
+		if _, err := tx.Exec(`DELETE FROM ` + tabela); err != nil {
+			return err
+		}
+	}
+
+	// Primeiro os ids: o lib/pq não permite outra query na transação com as linhas ainda abertas
+	rows, err := tx.Query(`SELECT id FROM veiculos_xml ORDER BY data_criacao, id`)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := atualizarVeiculosAtuais(tx, id); err != nil {
+			return err
+		}
+		if err := registarHistorico(tx, id); err != nil {
+			return err
+		}
+		if err := registarAnuncios(tx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PoliticaVeiculos decide qual das observações de um IDInterno conta nas estatísticas,
+// quando o mesmo veículo aparece em vários uploads (POLITICA_VEICULOS)
+type PoliticaVeiculos string
+
+const (
+	PoliticaRecente   PoliticaVeiculos = "latest"             // A observação mais recente (data_criacao do documento)
+	PoliticaPrimeira  PoliticaVeiculos = "first-seen"         // A primeira observação
+	PoliticaConfianca PoliticaVeiculos = "highest-confidence" // A observação com mais campos com valor real; empate vai para a mais recente
+)
+
+// confiancaVeiculo conta os campos com valor real de uma linha de veiculos, para a política highest-confidence.
+// O mapper preenche as células vazias com o valor por defeito (0, 0.0 ou N/A, ver mappers/), por isso esses
+// valores contam como em falta tal como os elementos ausentes; senão todas as observações teriam a mesma contagem.
+const confiancaVeiculo = `num_nonnulls(NULLIF(designacao, 'N/A'), NULLIF(categoria, 'N/A'), NULLIF(preco, 0),
+	NULLIF(ano, 0), NULLIF(cilindrada, 0), NULLIF(potencia, 0), NULLIF(combustivel, 'N/A'), NULLIF(transmissao, 'N/A'),
+	NULLIF(kms, 0), NULLIF(cidade, 'N/A'), NULLIF(lat, 0), NULLIF(lon, 0))`
+
+// chavePolitica é a chave pela qual cada política compara as observações de um IDInterno: fica a de
+// maior chave, ou a de menor se maior for false. O documento_id e a posição desempatam documentos com
+// a mesma data_criacao, para que a escolha nunca dependa da ordem física das linhas nem da ordem dos uploads.
+type chavePolitica struct {
+	colunas []string
+	maior   bool
+}
+
+var chavesPolitica = map[PoliticaVeiculos]chavePolitica{
+	PoliticaRecente:   {[]string{"data_documento", "documento_id", "posicao"}, true},
+	PoliticaPrimeira:  {[]string{"data_documento", "documento_id", "posicao"}, false},
+	PoliticaConfianca: {[]string{"confianca", "data_documento", "documento_id", "posicao"}, true},
+}
+
+// politicasVeiculos fixa a ordem em que o SaveXML atualiza veiculos_atuais: a ordem de um range sobre
+// chavesPolitica muda em cada execução, e dois SaveXML em ordens diferentes podiam bloquear-se um ao outro
+var politicasVeiculos = []PoliticaVeiculos{PoliticaRecente, PoliticaPrimeira, PoliticaConfianca}
+
+// chaveAtuais serializa a atualização de veiculos_atuais entre uploads concorrentes
+const chaveAtuais = 7203122
+
+// ParsePoliticaVeiculos valida o nome da política; vazio é latest
+func ParsePoliticaVeiculos(nome string) (PoliticaVeiculos, error) {
+	if nome == "" {
+		return PoliticaRecente, nil
+	}
+	p := PoliticaVeiculos(nome)
+	if _, ok := chavesPolitica[p]; !ok {
+		return "", fmt.Errorf("política de veículos desconhecida: %s (latest, first-seen ou highest-confidence)", nome)
+	}
+	return p, nil
+}
+
+// atualizacaoAtuais propõe, para cada IDInterno do documento $2, a sua melhor observação nesse documento
+// e só substitui a observação atual da política $1 se a nova ganhar pela chave
+func (c chavePolitica) atualizacaoAtuais() string {
+	ordem := make([]string, len(c.colunas))
+	novos := make([]string, len(c.colunas))
+	atuais := make([]string, len(c.colunas))
+	for i, col := range c.colunas {
+		ordem[i] = col
+		if c.maior {
+			ordem[i] += " DESC"
+		}
+		novos[i] = "EXCLUDED." + col
+		atuais[i] = "veiculos_atuais." + col
+	}
+	comparacao := "<"
+	if c.maior {
+		comparacao = ">"
+	}
+	return `
+	INSERT INTO veiculos_atuais (politica, id_interno, veiculo_id, confianca, data_documento, documento_id, posicao)
+	SELECT DISTINCT ON (id_interno) $1::text, id_interno, id, confianca, data_documento, documento_id, posicao
+	FROM (SELECT v.*, ` + confiancaVeiculo + ` AS confianca FROM veiculos v WHERE v.documento_id = $2) v
+	ORDER BY id_interno, ` + strings.Join(ordem, ", ") + `
+	ON CONFLICT (politica, id_interno) DO UPDATE SET veiculo_id = EXCLUDED.veiculo_id, confianca = EXCLUDED.confianca,
+		data_documento = EXCLUDED.data_documento, documento_id = EXCLUDED.documento_id, posicao = EXCLUDED.posicao
+	WHERE (` + strings.Join(novos, ", ") + `) ` + comparacao + ` (` + strings.Join(atuais, ", ") + `)`
+}
+
+// atualizarVeiculosAtuais junta as observações de um documento acabado de projetar a veiculos_atuais,
+// em todas as políticas, para que mudar POLITICA_VEICULOS não obrigue a reconstruir nada
+func atualizarVeiculosAtuais(tx *sql.Tx, documentoID int64) error {
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, chaveAtuais); err != nil {
+		return err
+	}
+	for _, p := range politicasVeiculos {
+		if _, err := tx.Exec(chavesPolitica[p].atualizacaoAtuais(), string(p), documentoID); err != nil {
+			return fmt.Errorf("política %s, documento %d: %v", p, documentoID, err)
+		}
+	}
+	return nil
+}
+
+// observacoes devolve a CTE "observacoes", com a linha de veiculos que a política escolheu para cada IDInterno
+// (ver veiculos_atuais). apenasAtivos deixa de fora os veículos sem anúncio aberto em nenhuma fonte (ver anuncios).
+func (p PoliticaVeiculos) observacoes(apenasAtivos bool) string {
+	if _, ok := chavesPolitica[p]; !ok {
+		p = PoliticaRecente
+	}
+	filtro := ""
+	if apenasAtivos {
+		filtro = `AND EXISTS (SELECT 1 FROM anuncios an WHERE an.id_interno = a.id_interno AND an.fim IS NULL)`
+	}
+	return `observacoes AS (
+			SELECT v.*
+			FROM veiculos_atuais a
+			JOIN veiculos v ON v.id = a.veiculo_id
+			WHERE a.politica = '` + string(p) + `'
+			` + filtro + `
+		)`
+}
+
+// ProjecaoPorConstruir indica documentos guardados antes de existir a projeção, as observações atuais,
+// o histórico ou os anúncios (uma das tabelas vazia quando já há documentos)
+func ProjecaoPorConstruir(db *sql.DB) (bool, error) {
+	var vazia bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM veiculos_xml) AND (NOT EXISTS (SELECT 1 FROM veiculos)
+		OR NOT EXISTS (SELECT 1 FROM veiculos_atuais) OR NOT EXISTS (SELECT 1 FROM veiculos_resumo) OR NOT EXISTS (SELECT 1 FROM anuncios))`).Scan(&vazia)
+	if err != nil {
+		log.Println("Erro ao verificar projeção de veículos:", err)
+	}
+	return vazia, err
+}
+
+// comandoReconstruirVeiculos trata "xml-service reconstruir-veiculos"
+func comandoReconstruirVeiculos(db *sql.DB) error {
+	inicio := time.Now()
+	documentos, veiculos, err := ReconstruirVeiculos(db)
+	if err != nil {
+		return err
+	}
+	log.Printf("Projeção reconstruída: %d veículos de %d documentos em %s\n", veiculos, documentos, time.Since(inicio).Round(time.Millisecond))
+	return nil
+}
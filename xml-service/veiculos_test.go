@@ -0,0 +1,289 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// bdTeste liga ao PostgreSQL de TEST_DATABASE_URL num esquema novo, com as migrações aplicadas,
+// que é apagado no fim do teste. Sem TEST_DATABASE_URL o teste é ignorado.
+func bdTeste(t *testing.T) *sql.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL não definido: testes com PostgreSQL ignorados")
+	}
+
+	admin, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	esquema := fmt.Sprintf("teste_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + esquema); err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(`DROP SCHEMA ` + esquema + ` CASCADE`)
+		admin.Close()
+	})
+
+	// O lib/pq envia os parâmetros que não conhece (search_path) ao servidor no arranque da ligação
+	separador := " "
+	if strings.Contains(url, "://") {
+		separador = "?"
+		if strings.Contains(url, "?") {
+			separador = "&"
+		}
+	}
+	db, err := sql.Open("postgres", url+separador+"search_path="+esquema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := AplicarMigracoes(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// veiculoTeste é um Veiculo escrito à mão; os campos vazios ficam fora do XML
+type veiculoTeste struct {
+	id, designacao, preco, kms, cidade string
+}
+
+func (v veiculoTeste) xml() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<Veiculo IDInterno="%s"><Identificacao>`, v.id)
+	if v.designacao != "" {
+		fmt.Fprintf(&b, `<Designacao>%s</Designacao>`, v.designacao)
+	}
+	if v.preco != "" {
+		fmt.Fprintf(&b, `<Preco>%s</Preco>`, v.preco)
+	}
+	b.WriteString(`</Identificacao>`)
+	if v.kms != "" {
+		fmt.Fprintf(&b, `<HistoricoUso><Kilometragem>%s</Kilometragem></HistoricoUso>`, v.kms)
+	}
+	if v.cidade != "" {
+		fmt.Fprintf(&b, `<Geografia><Cidade>%s</Cidade></Geografia>`, v.cidade)
+	}
+	b.WriteString(`</Veiculo>`)
+	return b.String()
+}
+
+// guardarDocumento guarda um RelatorioVeiculos com os veículos dados e devolve o id do documento
+func guardarDocumento(t *testing.T, db *sql.DB, reqID string, veiculos ...veiculoTeste) int64 {
+	t.Helper()
+	return guardarParcial(t, db, reqID, Rejeitados{}, veiculos...)
+}
+
+// guardarParcial guarda o documento de um upload em que a validação rejeitou algumas linhas
+func guardarParcial(t *testing.T, db *sql.DB, reqID string, rejeitados Rejeitados, veiculos ...veiculoTeste) int64 {
+	t.Helper()
+	var stock strings.Builder
+	for _, v := range veiculos {
+		stock.WriteString(v.xml())
+	}
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<RelatorioVeiculos DataGeracao="2026-01-01" Versao="1.0"><Configuracao ValidadoPor="teste" Requisitante="teste"></Configuracao><Stock>` +
+		stock.String() + `</Stock></RelatorioVeiculos>`
+
+	id, err := SaveXML(db, reqID, doc, "1.0", "1.0", "teste", rejeitados)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+type precoKms struct {
+	preco, kms sql.NullFloat64
+}
+
+func lerProjecao(t *testing.T, db *sql.DB, documentoID int64) map[string]precoKms {
+	t.Helper()
+	rows, err := db.Query(`SELECT id_interno, preco, kms FROM veiculos WHERE documento_id = $1`, documentoID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	linhas := map[string]precoKms{}
+	for rows.Next() {
+		var id string
+		var l precoKms
+		if err := rows.Scan(&id, &l.preco, &l.kms); err != nil {
+			t.Fatal(err)
+		}
+		linhas[id] = l
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return linhas
+}
+
+func valor(v float64) sql.NullFloat64 { return sql.NullFloat64{Float64: v, Valid: true} }
+
+var nulo = sql.NullFloat64{}
+
+func TestProjecaoVeiculosEsparsos(t *testing.T) {
+	db := bdTeste(t)
+
+	// B não tem Kilometragem e C não tem Preco: A e D têm de ficar com os próprios valores
+	docID := guardarDocumento(t, db, "esparso",
+		veiculoTeste{id: "A", designacao: "Renault Clio", preco: "10000", kms: "50000"},
+		veiculoTeste{id: "B", designacao: "Renault Megane", preco: "20000"},
+		veiculoTeste{id: "C", designacao: "Renault Captur", kms: "70000"},
+		veiculoTeste{id: "D", designacao: "Renault Zoe", preco: "30000", kms: "80000"},
+	)
+	esperado := map[string]precoKms{
+		"A": {valor(10000), valor(50000)},
+		"B": {valor(20000), nulo},
+		"C": {nulo, valor(70000)},
+		"D": {valor(30000), valor(80000)},
+	}
+
+	verificar := func(etapa string) {
+		t.Helper()
+		linhas := lerProjecao(t, db, docID)
+		if len(linhas) != len(esperado) {
+			t.Fatalf("%s: %d veículos projetados, esperados %d", etapa, len(linhas), len(esperado))
+		}
+		for id, e := range esperado {
+			if l := linhas[id]; l != e {
+				t.Errorf("%s: veículo %s com preco/kms %v/%v, esperado %v/%v", etapa, id, l.preco, l.kms, e.preco, e.kms)
+			}
+		}
+
+		// Os valores em falta saem das médias em vez de contarem como zero
+		total, precoMedio, kmsMedio := GetMarcaStats(db, PoliticaRecente, false, "Renault")
+		if total != 4 {
+			t.Errorf("%s: %d veículos nas estatísticas, esperados 4", etapa, total)
+		}
+		if math.Abs(float64(precoMedio)-20000) > 0.01 {
+			t.Errorf("%s: preço médio %v, esperado 20000", etapa, precoMedio)
+		}
+		if math.Abs(float64(kmsMedio)-200000.0/3) > 0.01 {
+			t.Errorf("%s: kms médios %v, esperados %v", etapa, kmsMedio, 200000.0/3)
+		}
+	}
+
+	verificar("SaveXML")
+	if _, _, err := ReconstruirVeiculos(db); err != nil {
+		t.Fatal(err)
+	}
+	verificar("reconstrução")
+}
+
+// observacoesAtuais devolve, para cada IDInterno, o documento da observação que a política escolheu
+func observacoesAtuais(t *testing.T, db *sql.DB, politica PoliticaVeiculos) map[string]int64 {
+	t.Helper()
+	rows, err := db.Query(`WITH ` + politica.observacoes(false) + ` SELECT id_interno, documento_id FROM observacoes`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	atuais := map[string]int64{}
+	for rows.Next() {
+		var id string
+		var documentoID int64
+		if err := rows.Scan(&id, &documentoID); err != nil {
+			t.Fatal(err)
+		}
+		if _, repetido := atuais[id]; repetido {
+			t.Fatalf("%s: veículo %s com mais de uma observação", politica, id)
+		}
+		atuais[id] = documentoID
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return atuais
+}
+
+func TestPoliticasVeiculos(t *testing.T) {
+	db := bdTeste(t)
+
+	// X tem todos os campos no primeiro documento e só valores por defeito do mapper (0, N/A) nos outros.
+	// Y aparece pela primeira vez no segundo documento, completo, e volta com valores por defeito no terceiro.
+	// Z está completo nos dois primeiros documentos: a confiança empata e ganha o mais recente.
+	doc1 := guardarDocumento(t, db, "politicas-1",
+		veiculoTeste{id: "X", designacao: "Seat Ibiza", preco: "10000", kms: "50000", cidade: "Lisboa"},
+		veiculoTeste{id: "Z", designacao: "Seat Leon", preco: "15000", kms: "30000", cidade: "Porto"},
+	)
+	doc2 := guardarDocumento(t, db, "politicas-2",
+		veiculoTeste{id: "X", designacao: "Seat Ibiza", preco: "12000", kms: "0", cidade: "N/A"},
+		veiculoTeste{id: "Y", designacao: "Seat Arona", preco: "20000", kms: "10000", cidade: "Braga"},
+		veiculoTeste{id: "Z", designacao: "Seat Leon", preco: "14000", kms: "31000", cidade: "Porto"},
+	)
+	doc3 := guardarDocumento(t, db, "politicas-3",
+		veiculoTeste{id: "X", designacao: "Seat Ibiza", preco: "11000", kms: "0", cidade: "N/A"},
+		veiculoTeste{id: "Y", designacao: "Seat Arona", preco: "0", kms: "0", cidade: "N/A"},
+	)
+
+	esperado := map[PoliticaVeiculos]map[string]int64{
+		PoliticaRecente:   {"X": doc3, "Y": doc3, "Z": doc2},
+		PoliticaPrimeira:  {"X": doc1, "Y": doc2, "Z": doc1},
+		PoliticaConfianca: {"X": doc1, "Y": doc2, "Z": doc2},
+	}
+	verificar := func(etapa string) {
+		t.Helper()
+		for politica, docs := range esperado {
+			atuais := observacoesAtuais(t, db, politica)
+			if len(atuais) != len(docs) {
+				t.Errorf("%s: %s com %d veículos, esperados %d", etapa, politica, len(atuais), len(docs))
+			}
+			for id, doc := range docs {
+				if atuais[id] != doc {
+					t.Errorf("%s: %s escolheu o documento %d para %s, esperado %d", etapa, politica, atuais[id], id, doc)
+				}
+			}
+			if total, _, _ := GetMarcaStats(db, politica, false, "Seat"); total != int32(len(docs)) {
+				t.Errorf("%s: %s conta %d veículos, esperados %d", etapa, politica, total, len(docs))
+			}
+		}
+	}
+	verificar("SaveXML")
+
+	// O segundo e o terceiro documento com a mesma data_criacao: desempata o id do documento
+	if _, err := db.Exec(`UPDATE veiculos_xml SET data_criacao = (SELECT data_criacao FROM veiculos_xml WHERE id = $1)
+		WHERE id = $2`, doc2, doc3); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ReconstruirVeiculos(db); err != nil {
+		t.Fatal(err)
+	}
+	verificar("mesma data_criacao")
+
+	// Os três documentos com a mesma data_criacao: latest e first-seen decidem só pelo id do documento
+	if _, err := db.Exec(`UPDATE veiculos_xml SET data_criacao = (SELECT data_criacao FROM veiculos_xml WHERE id = $1)
+		WHERE id = $2`, doc1, doc2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE veiculos_xml SET data_criacao = (SELECT data_criacao FROM veiculos_xml WHERE id = $1)
+		WHERE id = $2`, doc1, doc3); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ReconstruirVeiculos(db); err != nil {
+		t.Fatal(err)
+	}
+	verificar("todos com a mesma data_criacao")
+}
+
+// Uma política nova em chavesPolitica tem de entrar também na ordem fixa do SaveXML
+func TestOrdemPoliticasVeiculos(t *testing.T) {
+	if len(politicasVeiculos) != len(chavesPolitica) {
+		t.Fatalf("%d políticas ordenadas, %d em chavesPolitica", len(politicasVeiculos), len(chavesPolitica))
+	}
+	for _, p := range politicasVeiculos {
+		if _, ok := chavesPolitica[p]; !ok {
+			t.Errorf("política %s sem chave", p)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	crand "crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"xml-service/assinatura"
+)
+
+// Estados de uma entrega na tabela webhook_outbox
+const (
+	EntregaPendente   = "pendente"
+	EntregaEntregue   = "entregue"
+	EntregaDeadLetter = "dead_letter"
+)
+
+const (
+	backoffBase   = 5 * time.Second
+	backoffMaximo = 30 * time.Minute
+	leaseEntrega  = 2 * time.Minute // Tempo reservado a uma tentativa antes de outra réplica a poder repetir
+
+	maxRespostaGuardada = 4096 // Bytes da resposta do destinatário guardados no histórico
+)
+
+// callWebhook regista o aviso ao webhookUrl do upload na outbox. Funciona como uma subscrição
+// pontual dos eventos job.completed/job.failed, mas mantém o payload direto (sem envelope).
+// Por defeito segue a versão mais recente do payload; versao=1 envia só os campos originais.
+func callWebhook(db *sql.DB, url string, versao int, evento string, data WebhookResponse) {
+	var jsonData []byte
+	if versao == WebhookPayloadV1 {
+		jsonData, _ = json.Marshal(WebhookResponseV1{RequestId: data.RequestId, Status: data.Status, FileName: data.FileName})
+	} else {
+		data.VersaoPayload = WebhookPayloadV2
+		jsonData, _ = json.Marshal(data)
+	}
+
+	if inserirEntrega(db, sql.NullInt64{}, evento, data.RequestId, url, jsonData) == nil {
+		fmt.Printf(">\nWebhook agendado [%s]: %s\n", data.Status, data.FileName)
+	}
+}
+
+// inserirEntrega cria uma entrega pendente na outbox (subscricaoID nulo para o webhookUrl do upload)
+func inserirEntrega(db *sql.DB, subscricaoID sql.NullInt64, evento string, reqID string, url string, payload []byte) error {
+	query := `INSERT INTO webhook_outbox (delivery_id, subscricao_id, evento, request_id, url, payload, estado, tentativas, proxima_tentativa, data_criacao)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, 0, $8, $8)`
+	_, err := db.Exec(query, novoDeliveryID(), subscricaoID, evento, reqID, url, string(payload), EntregaPendente, time.Now())
+	if err != nil {
+		fmt.Printf("! Erro Webhook: %v\n", err)
+	}
+	return err
+}
+
+// EntregadorWebhooks envia as entregas pendentes da outbox, com backoff exponencial e jitter.
+// Uma entrega só conta como feita com uma resposta 2xx; ao fim de maxTentativas passa a dead_letter.
+type EntregadorWebhooks struct {
+	db            *sql.DB
+	cliente       *http.Client
+	maxTentativas int
+	segredo       []byte // WEBHOOK_SECRET, partilhado com quem recebe (ver pacote assinatura)
+}
+
+type entregaWebhook struct {
+	id           int64
+	deliveryID   string
+	subscricaoID sql.NullInt64
+	url          string
+	payload      string
+	tentativas   int
+}
+
+// NovoEntregadorWebhooks arranca o ciclo de entregas em background
+func NovoEntregadorWebhooks(db *sql.DB, timeout time.Duration, maxTentativas int, segredo string) *EntregadorWebhooks {
+	e := &EntregadorWebhooks{
+		db:            db,
+		cliente:       &http.Client{Timeout: timeout},
+		maxTentativas: maxTentativas,
+		segredo:       []byte(segredo),
+	}
+	if segredo == "" {
+		log.Println("! WEBHOOK_SECRET não definido e WEBHOOK_SEM_ASSINATURA=true: os webhooks do upload vão ser enviados sem assinatura")
+	}
+	go e.ciclo()
+	return e
+}
+
+func (e *EntregadorWebhooks) ciclo() {
+	for {
+		entrega, err := e.reclamar()
+		if err != nil {
+			log.Println("Erro ao ler outbox de webhooks:", err)
+		}
+		if entrega == nil {
+			time.Sleep(time.Second)
+			continue
+		}
+		e.entregar(entrega, false)
+	}
+}
+
+// reclamar escolhe a próxima entrega vencida e adia-a pelo lease, para que outra réplica não a repita
+func (e *EntregadorWebhooks) reclamar() (*entregaWebhook, error) {
+	query := `
+		UPDATE webhook_outbox SET proxima_tentativa = $2
+		WHERE id = (
+			SELECT id FROM webhook_outbox
+			WHERE estado = $3 AND proxima_tentativa <= $1
+			ORDER BY proxima_tentativa
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, delivery_id, subscricao_id, url, payload, tentativas`
+
+	agora := time.Now()
+	en := &entregaWebhook{}
+	err := e.db.QueryRow(query, agora, agora.Add(leaseEntrega), EntregaPendente).Scan(&en.id, &en.deliveryID, &en.subscricaoID, &en.url, &en.payload, &en.tentativas)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return en, nil
+}
+
+// entregar faz uma tentativa, guarda-a no histórico e atualiza a outbox com o resultado
+func (e *EntregadorWebhooks) entregar(en *entregaWebhook, manual bool) *TentativaEntrega {
+	en.tentativas++
+	inicio := time.Now()
+	codigo, resposta, erro := e.enviar(en)
+	agora := time.Now()
+
+	t := &TentativaEntrega{
+		EntregaId:     en.id,
+		Tentativa:     en.tentativas,
+		Manual:        manual,
+		Corpo:         en.payload,
+		Resposta:      resposta,
+		LatenciaMs:    agora.Sub(inicio).Milliseconds(),
+		DataTentativa: agora,
+	}
+	if codigo > 0 {
+		t.CodigoResposta = &codigo
+	}
+	if erro != nil {
+		t.Erro = erro.Error()
+	}
+	RegistarTentativa(e.db, t)
+
+	if erro == nil {
+		_, err := e.db.Exec(`UPDATE webhook_outbox SET estado = $2, tentativas = $3, ultimo_erro = NULL, data_entrega = $4 WHERE id = $1`,
+			en.id, EntregaEntregue, en.tentativas, agora)
+		if err != nil {
+			log.Println("Erro ao atualizar outbox:", err)
+		}
+		fmt.Printf(">\nWebhook avisado (tentativa %d): %s\n", en.tentativas, en.url)
+		return t
+	}
+
+	// Uma tentativa manual falhada conta no histórico mas deixa o estado e o backoff como estavam
+	if manual {
+		_, err := e.db.Exec(`UPDATE webhook_outbox SET tentativas = $2, ultimo_erro = $3 WHERE id = $1`, en.id, en.tentativas, erro.Error())
+		if err != nil {
+			log.Println("Erro ao atualizar outbox:", err)
+		}
+		fmt.Printf("! Erro Webhook (tentativa manual %d): %v\n", en.tentativas, erro)
+		return t
+	}
+
+	estado := EntregaPendente
+	if en.tentativas >= e.maxTentativas {
+		estado = EntregaDeadLetter
+		log.Printf("! Webhook %d para %s desistido ao fim de %d tentativas: %v\n", en.id, en.url, en.tentativas, erro)
+	} else {
+		fmt.Printf("! Erro Webhook (tentativa %d): %v\n", en.tentativas, erro)
+	}
+
+	_, err := e.db.Exec(`UPDATE webhook_outbox SET estado = $2, tentativas = $3, ultimo_erro = $4, proxima_tentativa = $5 WHERE id = $1`,
+		en.id, estado, en.tentativas, erro.Error(), agora.Add(backoff(en.tentativas)))
+	if err != nil {
+		log.Println("Erro ao atualizar outbox:", err)
+	}
+	return t
+}
+
+// enviar faz o POST assinado e só aceita respostas 2xx.
+// Devolve o código HTTP (0 se não houve resposta) e o início do corpo da resposta.
+func (e *EntregadorWebhooks) enviar(en *entregaWebhook) (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, en.url, bytes.NewBufferString(en.payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(assinatura.CabecalhoId, en.deliveryID)
+
+	// As subscrições assinam com o seu próprio segredo; o webhookUrl do upload usa WEBHOOK_SECRET
+	segredo := e.segredo
+	if en.subscricaoID.Valid {
+		s, err := GetSegredoSubscricao(e.db, en.subscricaoID.Int64)
+		if err != nil {
+			return 0, "", fmt.Errorf("subscrição %d indisponível: %v", en.subscricaoID.Int64, err)
+		}
+		segredo = []byte(s)
+	}
+	if len(segredo) > 0 {
+		ts := time.Now().Unix()
+		req.Header.Set(assinatura.CabecalhoTimestamp, strconv.FormatInt(ts, 10))
+		req.Header.Set(assinatura.CabecalhoAssinatura, assinatura.Assinar(segredo, en.deliveryID, ts, []byte(en.payload)))
+	}
+
+	resp, err := e.cliente.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	corpo, _ := io.ReadAll(io.LimitReader(resp.Body, maxRespostaGuardada))
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, string(corpo), fmt.Errorf("resposta %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(corpo), nil
+}
+
+// novoDeliveryID gera o identificador único de uma entrega
+func novoDeliveryID() string {
+	b := make([]byte, 16)
+	crand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// backoff devolve a espera antes da tentativa seguinte: base * 2^(n-1), limitada, com jitter
+func backoff(tentativas int) time.Duration {
+	espera := backoffBase << (tentativas - 1)
+	if espera > backoffMaximo || espera <= 0 {
+		espera = backoffMaximo
+	}
+	// Jitter: entre metade e a totalidade da espera, para não sincronizar réplicas
+	return espera/2 + time.Duration(rand.Int63n(int64(espera/2)+1))
+}
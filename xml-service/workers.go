@@ -0,0 +1,257 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// chaveFila serializa as submissões, para a contagem da fila e a inserção contarem como um só passo
+const chaveFila = 7203121
+
+// PoolWorkers processa os uploads com um número fixo de workers, a partir da tabela
+// fila_uploads. Como a fila vive no PostgreSQL, os pedidos sobrevivem a um restart do
+// contentor e várias réplicas podem partilhar o trabalho (SELECT ... FOR UPDATE SKIP LOCKED).
+type PoolWorkers struct {
+	db            *sql.DB
+	mappers       *RegistoMappers
+	esquemas      *RegistoEsquemas
+	delta         *EsquemaXSD
+	regras        *MotorRegras
+	workers       int
+	capacidade    int
+	instancia     string        // Identifica esta réplica nos pedidos reclamados
+	lease         time.Duration // Sem renovação durante este tempo, um pedido em curso é dado como abandonado
+	maxTentativas int           // Um pedido reclamado mais vezes do que isto falha (o CSV deita o processo abaixo)
+	acordar       chan struct{}
+	emCurso       atomic.Int64
+}
+
+// NovoPoolWorkers arranca os workers; capacidade é o número máximo de pedidos em espera
+func NovoPoolWorkers(db *sql.DB, mappers *RegistoMappers, esquemas *RegistoEsquemas, delta *EsquemaXSD, regras *MotorRegras, workers int, capacidade int) *PoolWorkers {
+	instancia, _ := os.Hostname()
+	p := &PoolWorkers{
+		db:            db,
+		mappers:       mappers,
+		esquemas:      esquemas,
+		delta:         delta,
+		regras:        regras,
+		workers:       workers,
+		capacidade:    capacidade,
+		instancia:     instancia,
+		lease:         time.Duration(envInt("FILA_LEASE_MINUTOS", 10)) * time.Minute,
+		maxTentativas: envInt("FILA_MAX_TENTATIVAS", 3),
+		acordar:       make(chan struct{}, workers),
+	}
+
+	// Pedidos que esta réplica tinha em curso quando foi abaixo voltam para a fila
+	res, err := db.Exec(`UPDATE fila_uploads SET estado = 'pendente', reclamado_por = NULL, reclamado_em = NULL
+		WHERE estado = 'em_curso' AND reclamado_por = $1`, instancia)
+	if err != nil {
+		log.Println("Erro ao recuperar fila de uploads:", err)
+	} else if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("%d pedidos por terminar voltaram para a fila\n", n)
+	}
+
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+	log.Printf("Pool de workers: %d workers, fila de %d pedidos (instância %s)\n", workers, capacidade, instancia)
+	return p
+}
+
+func (p *PoolWorkers) worker() {
+	for {
+		pedido, err := p.reclamar()
+		if err != nil {
+			log.Println("Erro ao reclamar pedido da fila:", err)
+		}
+		if pedido == nil {
+			// Fila vazia: espera por um pedido novo ou volta a ver daqui a pouco (outras réplicas)
+			select {
+			case <-p.acordar:
+			case <-time.After(2 * time.Second):
+			}
+			continue
+		}
+
+		p.emCurso.Add(1)
+		parar := make(chan struct{})
+		go p.renovar(pedido.RequestId, parar)
+
+		m, ok := p.mappers.Obter(pedido.MapperVersion)
+		switch {
+		case pedido.EstadoJob == EstadoPersisted || pedido.EstadoJob == EstadoFailed:
+			// O job já terminou numa tentativa que caiu antes de retirar o pedido da fila
+			log.Printf("Pedido %s já terminado (%s), retirado da fila\n", pedido.RequestId, pedido.EstadoJob)
+		case pedido.Tentativas > p.maxTentativas:
+			log.Printf("Pedido %s desistido ao fim de %d tentativas\n", pedido.RequestId, pedido.Tentativas-1)
+			FinishJob(p.db, pedido.RequestId, EstadoFailed, fmt.Sprintf("ERRO_TENTATIVAS: %d tentativas sem terminar", pedido.Tentativas-1), nil, pedido.DocumentoId)
+		case !ok:
+			FinishJob(p.db, pedido.RequestId, EstadoFailed, "ERRO_MAPPER: versão desconhecida "+pedido.MapperVersion, nil, 0)
+		default:
+			pedido.Mapper = m
+			pedido.Esquemas = p.esquemas
+			pedido.EsquemaDelta = p.delta
+			pedido.Regras = p.regras
+			processarUpload(p.db, *pedido)
+		}
+
+		close(parar)
+		p.concluir(pedido.RequestId)
+		p.emCurso.Add(-1)
+	}
+}
+
+// ErrPedidoEmCurso indica que o requestId ainda está na fila e não pode ser reenviado
+var ErrPedidoEmCurso = errors.New("pedido ainda em processamento")
+
+// Submeter grava o pedido e o respetivo job numa só transação, antes de responder 202.
+// Devolve false se a fila já tiver o número máximo de pedidos pendentes.
+func (p *PoolWorkers) Submeter(pedido PedidoUpload) (bool, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Com o lock, dois uploads ao mesmo tempo não passam ambos a contagem com um só lugar livre
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, chaveFila); err != nil {
+		return false, err
+	}
+	var pendentes int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM fila_uploads WHERE estado = 'pendente'`).Scan(&pendentes); err != nil {
+		return false, err
+	}
+	if pendentes >= p.capacidade {
+		return false, nil
+	}
+
+	agora := time.Now()
+	res, err := tx.Exec(`INSERT INTO fila_uploads (request_id, file_name, webhook_url, webhook_versao, mapper_version, versao_xsd, fonte, csv, estado, data_criacao)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 'pendente', $9)
+		ON CONFLICT (request_id) DO NOTHING`,
+		pedido.RequestId, pedido.FileName, pedido.WebhookURL, pedido.WebhookVersao, pedido.MapperVersion, pedido.VersaoXSD, pedido.Fonte, pedido.CSV, agora)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, ErrPedidoEmCurso
+	}
+
+	// Com force=true o mesmo requestId pode voltar a ser processado: o job é reposto a queued
+	_, err = tx.Exec(`INSERT INTO jobs (request_id, file_name, mapper_version, csv_sha256, estado, data_criacao, data_atualizacao)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		ON CONFLICT (request_id) DO UPDATE SET file_name = $2, mapper_version = $3, csv_sha256 = $4, estado = $5,
+			status_final = NULL, linhas_lidas = 0, linhas_aceites = 0, linhas_rejeitadas = 0, documento_id = NULL,
+			data_atualizacao = $6, data_conclusao = NULL`,
+		pedido.RequestId, pedido.FileName, pedido.MapperVersion, pedido.CsvSha256, EstadoQueued, agora)
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	select {
+	case p.acordar <- struct{}{}:
+	default:
+	}
+	return true, nil
+}
+
+// reclamar retira da fila o pedido pendente mais antigo (ou um abandonado por outra réplica).
+// O SKIP LOCKED garante que duas réplicas nunca reclamam o mesmo pedido. Com o pedido vem o estado
+// do job, para uma nova tentativa saber se a anterior já terminou ou já guardou o documento.
+func (p *PoolWorkers) reclamar() (*PedidoUpload, error) {
+	query := `
+		UPDATE fila_uploads f SET estado = 'em_curso', reclamado_por = $1, reclamado_em = $2, tentativas = tentativas + 1
+		WHERE request_id = (
+			SELECT request_id FROM fila_uploads
+			WHERE estado = 'pendente' OR (estado = 'em_curso' AND reclamado_em < $3)
+			ORDER BY data_criacao
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING request_id, file_name, webhook_url, webhook_versao, mapper_version, versao_xsd, fonte, csv, tentativas,
+			(SELECT j.estado FROM jobs j WHERE j.request_id = f.request_id),
+			(SELECT j.documento_id FROM jobs j WHERE j.request_id = f.request_id)`
+
+	agora := time.Now()
+	pedido := &PedidoUpload{}
+	var estado sql.NullString
+	var documento sql.NullInt64
+	err := p.db.QueryRow(query, p.instancia, agora, agora.Add(-p.lease)).Scan(
+		&pedido.RequestId, &pedido.FileName, &pedido.WebhookURL, &pedido.WebhookVersao, &pedido.MapperVersion, &pedido.VersaoXSD, &pedido.Fonte, &pedido.CSV,
+		&pedido.Tentativas, &estado, &documento)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pedido.EstadoJob = estado.String
+	pedido.DocumentoId = documento.Int64
+	return pedido, nil
+}
+
+// renovar mantém o pedido reclamado enquanto é processado, para outra réplica não o dar como
+// abandonado a meio de um CSV grande. Termina quando parar é fechado.
+func (p *PoolWorkers) renovar(reqID string, parar <-chan struct{}) {
+	ticker := time.NewTicker(p.lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-parar:
+			return
+		case <-ticker.C:
+			res, err := p.db.Exec(`UPDATE fila_uploads SET reclamado_em = $3 WHERE request_id = $1 AND reclamado_por = $2 AND estado = 'em_curso'`,
+				reqID, p.instancia, time.Now())
+			if err != nil {
+				log.Println("Erro ao renovar pedido da fila:", err)
+			} else if n, _ := res.RowsAffected(); n == 0 {
+				log.Printf("Pedido %s já não pertence a esta réplica\n", reqID)
+				return
+			}
+		}
+	}
+}
+
+// concluir retira da fila um pedido já processado (o CSV deixa de ser necessário).
+// Se entretanto outra réplica o reclamou, o pedido fica para ela.
+func (p *PoolWorkers) concluir(reqID string) {
+	if _, err := p.db.Exec(`DELETE FROM fila_uploads WHERE request_id = $1 AND reclamado_por = $2`, reqID, p.instancia); err != nil {
+		log.Println("Erro ao retirar pedido da fila:", err)
+	}
+}
+
+// Pendentes devolve o número de pedidos à espera de um worker (em todas as réplicas)
+func (p *PoolWorkers) Pendentes() int {
+	var n int
+	if err := p.db.QueryRow(`SELECT COUNT(*) FROM fila_uploads WHERE estado = 'pendente'`).Scan(&n); err != nil {
+		log.Println("Erro ao contar fila de uploads:", err)
+	}
+	return n
+}
+
+// handlerMetricas expõe o estado da fila no formato de texto do Prometheus
+func (p *PoolWorkers) handlerMetricas(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP xml_service_fila_pendentes Pedidos de upload à espera de um worker.\n")
+	fmt.Fprintf(w, "# TYPE xml_service_fila_pendentes gauge\n")
+	fmt.Fprintf(w, "xml_service_fila_pendentes %d\n", p.Pendentes())
+	fmt.Fprintf(w, "# HELP xml_service_fila_capacidade Capacidade máxima da fila de uploads.\n")
+	fmt.Fprintf(w, "# TYPE xml_service_fila_capacidade gauge\n")
+	fmt.Fprintf(w, "xml_service_fila_capacidade %d\n", p.capacidade)
+	fmt.Fprintf(w, "# HELP xml_service_jobs_em_curso Uploads a ser processados neste momento (nesta réplica).\n")
+	fmt.Fprintf(w, "# TYPE xml_service_jobs_em_curso gauge\n")
+	fmt.Fprintf(w, "xml_service_jobs_em_curso %d\n", p.emCurso.Load())
+	fmt.Fprintf(w, "# HELP xml_service_workers Número de workers configurados.\n")
+	fmt.Fprintf(w, "# TYPE xml_service_workers gauge\n")
+	fmt.Fprintf(w, "xml_service_workers %d\n", p.workers)
+}